@@ -0,0 +1,22 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package main
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID is the identity of a file which stays the same whatever path leads to it
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+func getFileID(info fs.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
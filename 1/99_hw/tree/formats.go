@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type jsonNode struct {
+	Name     string      `json:"name"`
+	Path     string      `json:"path,omitempty"`
+	Dir      bool        `json:"dir"`
+	Size     *int64      `json:"size,omitempty"`
+	SizeText string      `json:"size_text,omitempty"`
+	Link     string      `json:"link,omitempty"`
+	Broken   bool        `json:"broken,omitempty"`
+	Loop     bool        `json:"loop,omitempty"`
+	Mode     string      `json:"mode"`
+	ModTime  time.Time   `json:"mtime"`
+	Children []*jsonNode `json:"children,omitempty"`
+	Top      []*jsonNode `json:"top,omitempty"`
+}
+
+// toJSON fills in the sizes only where the text output has them
+func toJSON(n *node, human bool, withPath bool, withChildren bool) *jsonNode {
+	result := &jsonNode{
+		Name:    n.Name,
+		Dir:     n.IsDir,
+		Link:    n.Link,
+		Broken:  n.Broken,
+		Loop:    n.Loop,
+		Mode:    n.Mode.String(),
+		ModTime: n.ModTime,
+	}
+	if withPath {
+		result.Path = n.Rel
+	}
+	if (!n.IsDir || n.Total) && !n.Broken && !n.Loop {
+		size := n.Size
+		result.Size = &size
+		result.SizeText = sizeString(n.Size, human)
+	}
+	if withChildren {
+		result.Children = make([]*jsonNode, 0, len(n.Children))
+		for _, child := range n.Children {
+			result.Children = append(result.Children, toJSON(child, human, withPath, withChildren))
+		}
+	}
+	return result
+}
+
+// jsonRenderer writes the whole tree as one nested object starting from the root directory
+type jsonRenderer struct{}
+
+func (jsonRenderer) Render(out io.Writer, t *tree) error {
+	result := toJSON(t.root, t.human, false, true)
+	for _, file := range t.top {
+		result.Top = append(result.Top, toJSON(file, t.human, true, false))
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+// ndjsonRenderer writes one object per line for every entry below the root in the text output order
+type ndjsonRenderer struct{}
+
+func (ndjsonRenderer) Render(out io.Writer, t *tree) error {
+	encoder := json.NewEncoder(out)
+	var render func(files []*node) error
+	render = func(files []*node) error {
+		for _, file := range files {
+			if err := encoder.Encode(toJSON(file, t.human, true, false)); err != nil {
+				return err
+			}
+			if err := render(file.Children); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return render(t.root.Children)
+}
+
+// dotRenderer writes a Graphviz digraph with an edge from every directory to its entries
+type dotRenderer struct{}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func (dotRenderer) Render(out io.Writer, t *tree) error {
+	if _, err := fmt.Fprintln(out, "digraph tree {"); err != nil {
+		return err
+	}
+	id := 0
+	var render func(file *node) (int, error)
+	render = func(file *node) (int, error) {
+		current := id
+		id++
+		shape := "note"
+		if file.IsDir {
+			shape = "folder"
+		}
+		if _, err := fmt.Fprintf(out, "\tn%d [label=\"%s\", shape=%s];\n", current, dotEscaper.Replace(fileString(file, t.human)), shape); err != nil {
+			return 0, err
+		}
+		for _, child := range file.Children {
+			childID, err := render(child)
+			if err != nil {
+				return 0, err
+			}
+			if _, err := fmt.Fprintf(out, "\tn%d -> n%d;\n", current, childID); err != nil {
+				return 0, err
+			}
+		}
+		return current, nil
+	}
+	if _, err := render(t.root); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out, "}")
+	return err
+}
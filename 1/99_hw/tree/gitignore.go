@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+type ignoreRule struct {
+	pattern []string
+	negate  bool
+	dirOnly bool
+	//anchored rules are matched against the path relative to the .gitignore, others only against the base name
+	anchored bool
+}
+
+type gitignore struct {
+	//base is the directory of the .gitignore relative to the tree root
+	base  string
+	rules []ignoreRule
+}
+
+// readGitignore returns nil without an error if there is no .gitignore at the path
+func readGitignore(path string, base string) (*gitignore, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseGitignore(file, base)
+}
+
+func parseGitignore(r io.Reader, base string) (*gitignore, error) {
+	gi := &gitignore{base: base}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+			gi.rules = append(gi.rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return gi, nil
+}
+
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	var rule ignoreRule
+	line = strings.TrimSuffix(line, "\r")
+	if !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimRight(line, " ")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\#") || strings.HasPrefix(line, "\\!") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	rule.anchored = strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return rule, false
+	}
+	rule.pattern = strings.Split(line, "/")
+	return rule, true
+}
+
+func (rule ignoreRule) matches(rel string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	segments := strings.Split(rel, "/")
+	if !rule.anchored {
+		return matchSegment(rule.pattern[0], segments[len(segments)-1])
+	}
+	return matchSegments(rule.pattern, segments)
+}
+
+// match returns whether any rule matched the path and if so whether it was a negating one,
+// the last matching rule wins as in git
+func (gi *gitignore) match(rel string, isDir bool) (matched bool, negate bool) {
+	if gi.base != "" {
+		rel = strings.TrimPrefix(rel, gi.base+"/")
+	}
+	for i := len(gi.rules) - 1; i >= 0; i-- {
+		if gi.rules[i].matches(rel, isDir) {
+			return true, gi.rules[i].negate
+		}
+	}
+	return false, false
+}
+
+// isIgnored checks the .gitignore files from the root down, so deeper files override upper ones
+func isIgnored(ignores []*gitignore, rel string, isDir bool) bool {
+	ignored := false
+	for _, gi := range ignores {
+		if matched, negate := gi.match(rel, isDir); matched {
+			ignored = !negate
+		}
+	}
+	return ignored
+}
@@ -1,24 +1,14 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"flag"
 	"io"
 	"os"
+	"os/signal"
+	"strings"
 )
 
-func fileString(file os.DirEntry) (string, error) {
-	info, err := file.Info()
-	if err != nil {
-		return "", err
-	}
-	name := info.Name()
-	size := info.Size()
-	if size == 0 {
-		return fmt.Sprintf("%s (empty)", name), nil
-	}
-	return fmt.Sprintf("%s (%db)", name, size), nil
-}
-
 func filter[T any](slice []T, predicate func(el T) bool) []T {
 	result := make([]T, 0, cap(slice))
 	for _, el := range slice {
@@ -29,76 +19,72 @@ func filter[T any](slice []T, predicate func(el T) bool) []T {
 	return result
 }
 
-func dirTreeRecursive(out io.Writer, path string, printFiles bool, prefix string) error {
-	files, err := os.ReadDir(path)
-	if err != nil {
+func dirTree(out io.Writer, path string, printFiles bool) error {
+	return dirTreeWithOptions(out, path, Options{PrintFiles: printFiles})
+}
+
+func dirTreeWithOptions(out io.Writer, path string, opts Options) error {
+	return dirTreeContext(context.Background(), out, path, opts)
+}
+
+// dirTreeContext stops walking as soon as the context is done, nothing is written in that case
+func dirTreeContext(ctx context.Context, out io.Writer, path string, opts Options) error {
+	if err := opts.validate(); err != nil {
 		return err
 	}
-	//need to filter because we need handle last element differently
-	//if we not filter may come problem that last element is file & prinfiles is disabled
-	//so this file actually is not last as we don't need to print it
-	if !printFiles {
-		files = filter(files, func(el os.DirEntry) bool {
-			return el.IsDir()
-		})
+	root, err := walkTree(ctx, path, opts)
+	if err != nil {
+		return err
 	}
-	if len(files) == 0 {
-		return nil
+	renderer := opts.Renderer
+	if renderer == nil {
+		renderer = textRenderer{}
 	}
+	return renderer.Render(out, summarize(root, opts))
+}
 
-	for _, file := range files[:len(files)-1] {
-		if err := printFile(out, path, printFiles, prefix, file, false); err != nil {
-			return err
-		}
-	}
+// patterns is a flag.Value collecting repeated or comma separated glob patterns
+type patterns []string
 
-	//last element
-	file := files[len(files)-1]
-	if err := printFile(out, path, printFiles, prefix, file, true); err != nil {
-		return err
-	}
-	return nil
+func (p *patterns) String() string {
+	return strings.Join(*p, ",")
 }
 
-func printFile(out io.Writer, path string, printFiles bool, prefix string, file os.DirEntry, isLast bool) error {
-	branchSymbol := "├"
-	addToPrefix := "│\t"
-	if isLast {
-		branchSymbol = "└"
-		addToPrefix = "\t"
-	}
-	if file.IsDir() {
-		if _, err := fmt.Fprintf(out, "%s%s\n", prefix+branchSymbol+"───", file.Name()); err != nil {
-			return err
-		}
-		if err := dirTreeRecursive(out, path+"/"+file.Name(), printFiles, prefix+addToPrefix); err != nil {
-			return err
-		}
-	} else {
-		str, err := fileString(file)
-		if err != nil {
-			return err
-		}
-		if _, err := fmt.Fprintf(out, "%s%s\n", prefix+branchSymbol+"───", str); err != nil {
-			return err
-		}
-	}
+func (p *patterns) Set(value string) error {
+	*p = append(*p, strings.Split(value, ",")...)
 	return nil
 }
 
-func dirTree(out io.Writer, path string, printFiles bool) error {
-	return dirTreeRecursive(out, path, printFiles, "")
-}
-
 func main() {
 	out := os.Stdout
-	if !(len(os.Args) == 2 || len(os.Args) == 3) {
-		panic("usage go run main.go . [-f]")
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		panic("usage go run main.go . [-f] [-L depth] [-P include] [-I exclude] [-gitignore] [-no-hidden] [-du] [-sort name|size] [-h] [-top N] [-l] [-workers N] [-format text|json|ndjson|dot]")
 	}
 	path := os.Args[1]
-	printFiles := len(os.Args) == 3 && os.Args[2] == "-f"
-	err := dirTree(out, path, printFiles)
+	var opts Options
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	flags.BoolVar(&opts.PrintFiles, "f", false, "print files")
+	flags.IntVar(&opts.MaxDepth, "L", 0, "max depth, 0 means no limit")
+	flags.Var((*patterns)(&opts.Include), "P", "glob pattern files have to match")
+	flags.Var((*patterns)(&opts.Exclude), "I", "glob pattern for files and directories to skip")
+	flags.BoolVar(&opts.RespectGitignore, "gitignore", false, "skip files matched by .gitignore")
+	flags.BoolVar(&opts.SkipHidden, "no-hidden", false, "skip hidden files and directories")
+	flags.BoolVar(&opts.DiskUsage, "du", false, "show total sizes of directories")
+	flags.StringVar(&opts.SortBy, "sort", "name", "sort entries by name or size")
+	flags.BoolVar(&opts.HumanSizes, "h", false, "print sizes in KiB, MiB")
+	flags.IntVar(&opts.TopN, "top", 0, "print a summary of the N largest files")
+	flags.BoolVar(&opts.FollowSymlinks, "l", false, "follow symbolic links")
+	flags.IntVar(&opts.Workers, "workers", 0, "number of concurrent filesystem calls, 0 or 1 walks sequentially")
+	format := flags.String("format", "text", "output format: text, json, ndjson or dot")
+	_ = flags.Parse(os.Args[2:])
+	renderer, err := rendererByName(*format)
 	if err != nil {
 		panic(err.Error())
 	}
+	opts.Renderer = renderer
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := dirTreeContext(ctx, out, path, opts); err != nil {
+		panic(err.Error())
+	}
 }
@@ -2,6 +2,14 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -73,3 +81,403 @@ func TestTreeDir(t *testing.T) {
 		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testDirResult)
 	}
 }
+
+func writeFixture(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+const testDepthResult = `├───project
+│	├───file.txt (19b)
+│	└───gopher.png (70372b)
+├───static
+│	├───a_lorem
+│	├───css
+│	├───empty.txt (empty)
+│	├───html
+│	├───js
+│	└───z_lorem
+├───zline
+│	├───empty.txt (empty)
+│	└───lorem
+└───zzfile.txt (empty)
+`
+
+func TestTreeMaxDepth(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeWithOptions(out, "testdata", Options{PrintFiles: true, MaxDepth: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result := out.String(); result != testDepthResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testDepthResult)
+	}
+}
+
+const testPatternsResult = `├───project
+│	└───gopher.png (70372b)
+└───zline
+	├───empty.txt (empty)
+	└───lorem
+		├───gopher.png (70372b)
+		└───ipsum
+			└───gopher.png (70372b)
+`
+
+func TestTreePatterns(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := Options{
+		PrintFiles: true,
+		Include:    []string{"*.png", "zline/*.txt"},
+		Exclude:    []string{"static", "zz*"},
+	}
+	err := dirTreeWithOptions(out, "testdata", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result := out.String(); result != testPatternsResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testPatternsResult)
+	}
+}
+
+func TestTreeBadPattern(t *testing.T) {
+	err := dirTreeWithOptions(new(bytes.Buffer), "testdata", Options{Exclude: []string{"[a"}})
+	if err == nil {
+		t.Errorf("expected error for malformed pattern")
+	}
+}
+
+const testGitignoreResult = `├───.gitignore (25b)
+├───app
+│	├───.gitignore (14b)
+│	├───keep.log (empty)
+│	└───main.go (empty)
+├───docs
+│	└───readme.md (empty)
+└───main.go (empty)
+`
+
+func TestTreeGitignore(t *testing.T) {
+	root := writeFixture(t, map[string]string{
+		".gitignore":          "*.log\nbuild/\n/docs/*.tmp\n",
+		".git/HEAD":           "",
+		"app/.gitignore":      "!keep.log\nbin\n",
+		"app/bin/app":         "",
+		"app/debug.log":       "",
+		"app/keep.log":        "",
+		"app/main.go":         "",
+		"build/out.bin":       "",
+		"docs/draft.tmp":      "",
+		"docs/readme.md":      "",
+		"docs/nested/old.tmp": "",
+		"main.go":             "",
+		"node_modules/pkg.js": "",
+		"server.log":          "",
+	})
+	out := new(bytes.Buffer)
+	opts := Options{
+		PrintFiles:       true,
+		Exclude:          []string{".git", "node_modules", "nested"},
+		RespectGitignore: true,
+	}
+	err := dirTreeWithOptions(out, root, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result := out.String(); result != testGitignoreResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testGitignoreResult)
+	}
+
+	out.Reset()
+	opts.SkipHidden = true
+	err = dirTreeWithOptions(out, root, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result := out.String(); strings.Contains(result, ".gitignore") {
+		t.Errorf("hidden files are printed\nGot:\n%v", result)
+	}
+}
+
+func TestTreeNDJSON(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeWithOptions(out, "testdata/zline", Options{PrintFiles: true, Renderer: ndjsonRenderer{}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []struct {
+		path     string
+		dir      bool
+		sizeText string
+	}{
+		{"empty.txt", false, "empty"},
+		{"lorem", true, ""},
+		{"lorem/dolor.txt", false, "empty"},
+		{"lorem/gopher.png", false, "70372b"},
+		{"lorem/ipsum", true, ""},
+		{"lorem/ipsum/gopher.png", false, "70372b"},
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d:\n%s", len(expected), len(lines), out.String())
+	}
+	for i, line := range lines {
+		var entry jsonNode
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line %d is not json: %v", i, err)
+		}
+		if entry.Path != expected[i].path || entry.Dir != expected[i].dir || entry.SizeText != expected[i].sizeText {
+			t.Errorf("line %d: got %s, expected %+v", i, line, expected[i])
+		}
+	}
+}
+
+func TestTreeJSON(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeWithOptions(out, "testdata", Options{Renderer: jsonRenderer{}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var root jsonNode
+	if err := json.Unmarshal(out.Bytes(), &root); err != nil {
+		t.Fatalf("output is not json: %v", err)
+	}
+	if root.Name != "testdata" || len(root.Children) != 3 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+	zline := root.Children[2]
+	if zline.Name != "zline" || !zline.Dir || zline.Size != nil || zline.Children[0].Children[0].Name != "ipsum" {
+		t.Errorf("unexpected zline: %+v", zline)
+	}
+}
+
+func TestTreeDOT(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeWithOptions(out, "testdata/project", Options{PrintFiles: true, Renderer: dotRenderer{}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `digraph tree {
+	n0 [label="project", shape=folder];
+	n1 [label="file.txt (19b)", shape=note];
+	n0 -> n1;
+	n2 [label="gopher.png (70372b)", shape=note];
+	n0 -> n2;
+}
+`
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+const testDiskUsageResult = `├───zline (140744b)
+│	├───lorem (140744b)
+│	│	├───gopher.png (70372b)
+│	│	├───ipsum (70372b)
+│	│	│	└───gopher.png (70372b)
+│	│	└───dolor.txt (empty)
+│	└───empty.txt (empty)
+├───project (70391b)
+│	├───gopher.png (70372b)
+│	└───file.txt (19b)
+└───zzfile.txt (empty)
+
+Top 2 largest files:
+70372b	project/gopher.png
+70372b	zline/lorem/gopher.png
+`
+
+func TestTreeDiskUsage(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := Options{
+		PrintFiles: true,
+		Exclude:    []string{"static"},
+		DiskUsage:  true,
+		SortBy:     "size",
+		TopN:       2,
+	}
+	err := dirTreeWithOptions(out, "testdata", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result := out.String(); result != testDiskUsageResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testDiskUsageResult)
+	}
+}
+
+func TestSizeString(t *testing.T) {
+	cases := []struct {
+		size     int64
+		human    bool
+		expected string
+	}{
+		{0, true, "empty"},
+		{19, false, "19b"},
+		{1023, true, "1023b"},
+		{70372, false, "70372b"},
+		{70372, true, "68.7KiB"},
+		{3 << 20, true, "3.0MiB"},
+		{5 << 30, true, "5.0GiB"},
+	}
+	for _, c := range cases {
+		if result := sizeString(c.size, c.human); result != c.expected {
+			t.Errorf("sizeString(%d, %v) = %q, expected %q", c.size, c.human, result, c.expected)
+		}
+	}
+}
+
+func TestTreeConcurrent(t *testing.T) {
+	for _, workers := range []int{2, 8} {
+		out := new(bytes.Buffer)
+		err := dirTreeWithOptions(out, "testdata", Options{PrintFiles: true, Workers: workers})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result := out.String(); result != testFullResult {
+			t.Errorf("%d workers: results not match\nGot:\n%v\nExpected:\n%v", workers, result, testFullResult)
+		}
+	}
+}
+
+func TestTreeCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, workers := range []int{0, 4} {
+		out := new(bytes.Buffer)
+		err := dirTreeContext(ctx, out, "testdata", Options{PrintFiles: true, Workers: workers})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%d workers: expected context.Canceled, got %v", workers, err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("%d workers: nothing has to be written, got:\n%v", workers, out.String())
+		}
+	}
+}
+
+func benchmarkFixture(b *testing.B) string {
+	b.Helper()
+	root := b.TempDir()
+	for i := 0; i < 20; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir%02d", i), "nested")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < 50; j++ {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%02d.txt", j)), []byte("gopher"), 0o644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	return root
+}
+
+func BenchmarkTreeSequential(b *testing.B) {
+	root := benchmarkFixture(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := dirTreeWithOptions(io.Discard, root, Options{PrintFiles: true}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTreeConcurrent(b *testing.B) {
+	root := benchmarkFixture(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := dirTreeWithOptions(io.Discard, root, Options{PrintFiles: true, Workers: 8}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func symlinkFixture(t *testing.T) string {
+	t.Helper()
+	root := writeFixture(t, map[string]string{
+		"data/file.txt": "hello",
+	})
+	links := [][2]string{
+		{"..", "data/back"},
+		{"data/file.txt", "link.txt"},
+		{"data", "dirlink"},
+		{"missing.txt", "broken"},
+	}
+	for _, link := range links {
+		if err := os.Symlink(link[0], filepath.Join(root, filepath.FromSlash(link[1]))); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+	return root
+}
+
+const testSymlinksResult = `├───broken -> missing.txt [broken]
+├───data
+│	├───back -> .. [loop]
+│	└───file.txt (5b)
+├───dirlink -> data
+│	├───back -> .. [loop]
+│	└───file.txt (5b)
+└───link.txt -> data/file.txt (5b)
+`
+
+func TestTreeFollowSymlinks(t *testing.T) {
+	root := symlinkFixture(t)
+	for _, workers := range []int{0, 4} {
+		out := new(bytes.Buffer)
+		err := dirTreeWithOptions(out, root, Options{PrintFiles: true, FollowSymlinks: true, Workers: workers})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result := out.String(); result != testSymlinksResult {
+			t.Errorf("%d workers: results not match\nGot:\n%v\nExpected:\n%v", workers, result, testSymlinksResult)
+		}
+	}
+}
+
+const testSymlinksDirResult = `├───data
+│	└───back -> .. [loop]
+└───dirlink -> data
+	└───back -> .. [loop]
+`
+
+func TestTreeFollowSymlinksDir(t *testing.T) {
+	root := symlinkFixture(t)
+	out := new(bytes.Buffer)
+	err := dirTreeWithOptions(out, root, Options{FollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result := out.String(); result != testSymlinksDirResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testSymlinksDirResult)
+	}
+}
+
+const testSymlinksNotFollowedResult = `├───broken (11b)
+├───data
+│	├───back (2b)
+│	└───file.txt (5b)
+├───dirlink (4b)
+└───link.txt (13b)
+`
+
+func TestTreeSymlinksNotFollowed(t *testing.T) {
+	root := symlinkFixture(t)
+	out := new(bytes.Buffer)
+	err := dirTreeWithOptions(out, root, Options{PrintFiles: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result := out.String(); result != testSymlinksNotFollowedResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testSymlinksNotFollowedResult)
+	}
+}
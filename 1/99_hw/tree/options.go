@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+type Options struct {
+	PrintFiles bool
+	//MaxDepth limits how many levels are printed, 0 means no limit
+	MaxDepth int
+	//Include are glob patterns a file has to match to be printed, directories are always walked
+	Include []string
+	//Exclude are glob patterns for files and directories that are skipped entirely
+	Exclude []string
+	//RespectGitignore skips everything matched by .gitignore files met during the walk
+	RespectGitignore bool
+	//SkipHidden skips files and directories which names start with a dot
+	SkipHidden bool
+	//DiskUsage shows directories with the total size of everything below them
+	DiskUsage bool
+	//SortBy orders the entries of a directory by "name" (the default) or by "size", largest first
+	SortBy string
+	//HumanSizes prints sizes in KiB, MiB and so on instead of bytes
+	HumanSizes bool
+	//TopN adds a summary of the N largest files, 0 disables it
+	TopN int
+	//FollowSymlinks walks linked directories, shows link targets, broken links and loops
+	FollowSymlinks bool
+	//Workers above 1 reads directories and stats entries concurrently, at most Workers calls at a time
+	Workers int
+	//Renderer writes the walked tree, the box-drawing text is used if it's nil
+	Renderer Renderer
+}
+
+func (opts Options) validate() error {
+	for _, patterns := range [][]string{opts.Include, opts.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("bad pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	if opts.MaxDepth < 0 {
+		return fmt.Errorf("bad max depth %d", opts.MaxDepth)
+	}
+	if opts.SortBy != "" && opts.SortBy != "name" && opts.SortBy != "size" {
+		return fmt.Errorf("bad sort order %q", opts.SortBy)
+	}
+	if opts.Workers < 0 {
+		return fmt.Errorf("bad workers count %d", opts.Workers)
+	}
+	if opts.TopN < 0 {
+		return fmt.Errorf("bad top count %d", opts.TopN)
+	}
+	return nil
+}
+
+// keep reports whether the entry at rel (path relative to the tree root) has to be walked
+func (opts Options) keep(file os.DirEntry, rel string, ignores []*gitignore) bool {
+	name := file.Name()
+	isDir := file.IsDir()
+	if !isDir && !opts.walkFiles() {
+		return false
+	}
+	if opts.SkipHidden && strings.HasPrefix(name, ".") {
+		return false
+	}
+	if matchAny(opts.Exclude, rel, name) {
+		return false
+	}
+	if !isDir && len(opts.Include) > 0 && !matchAny(opts.Include, rel, name) {
+		return false
+	}
+	if opts.RespectGitignore && isIgnored(ignores, rel, isDir) {
+		return false
+	}
+	return true
+}
+
+// descend reports whether children of a directory at the given depth (root is 0) are printed
+func (opts Options) descend(depth int) bool {
+	return opts.MaxDepth == 0 || depth < opts.MaxDepth
+}
+
+// walkFiles reports whether files are needed even if they are not printed, to count sizes
+func (opts Options) walkFiles() bool {
+	return opts.PrintFiles || opts.walkAll()
+}
+
+// walkAll reports whether the walk has to go below the max depth, to count sizes
+func (opts Options) walkAll() bool {
+	return opts.DiskUsage || opts.TopN > 0
+}
+
+func matchAny(patterns []string, rel string, name string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, rel, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches patterns without a slash against the base name
+// and patterns with a slash against the whole relative path, "**" matches any number of directories
+func matchGlob(pattern string, rel string, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		return matchSegment(pattern, name)
+	}
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(rel, "/"))
+}
+
+func matchSegment(pattern string, name string) bool {
+	matched, err := path.Match(pattern, name)
+	return err == nil && matched
+}
+
+func matchSegments(pattern []string, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return len(segments) > 0
+			}
+			for i := range segments {
+				if matchSegments(pattern, segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 || !matchSegment(pattern[0], segments[0]) {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+func joinRel(rel string, name string) string {
+	if rel == "" {
+		return name
+	}
+	return rel + "/" + name
+}
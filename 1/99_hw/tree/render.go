@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+type Renderer interface {
+	Render(out io.Writer, t *tree) error
+}
+
+var renderers = map[string]Renderer{
+	"text":   textRenderer{},
+	"json":   jsonRenderer{},
+	"ndjson": ndjsonRenderer{},
+	"dot":    dotRenderer{},
+}
+
+func rendererByName(name string) (Renderer, error) {
+	renderer, ok := renderers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", name)
+	}
+	return renderer, nil
+}
+
+// textRenderer draws the tree with box-drawing symbols, it's the default one
+type textRenderer struct{}
+
+func (textRenderer) Render(out io.Writer, t *tree) error {
+	if err := printLevel(out, t.root.Children, "", t.human); err != nil {
+		return err
+	}
+	if len(t.top) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(out, "\nTop %d largest files:\n", len(t.top)); err != nil {
+		return err
+	}
+	for _, file := range t.top {
+		if _, err := fmt.Fprintf(out, "%s\t%s\n", sizeString(file.Size, t.human), file.Rel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printLevel(out io.Writer, files []*node, prefix string, human bool) error {
+	if len(files) == 0 {
+		return nil
+	}
+	for _, file := range files[:len(files)-1] {
+		if err := printFile(out, prefix, file, false, human); err != nil {
+			return err
+		}
+	}
+
+	//last element
+	return printFile(out, prefix, files[len(files)-1], true, human)
+}
+
+func printFile(out io.Writer, prefix string, file *node, isLast bool, human bool) error {
+	branchSymbol := "├"
+	addToPrefix := "│\t"
+	if isLast {
+		branchSymbol = "└"
+		addToPrefix = "\t"
+	}
+	if _, err := fmt.Fprintf(out, "%s%s\n", prefix+branchSymbol+"───", fileString(file, human)); err != nil {
+		return err
+	}
+	if file.IsDir {
+		return printLevel(out, file.Children, prefix+addToPrefix, human)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// tree is the walked root with everything computed once for all renderers
+type tree struct {
+	root  *node
+	human bool
+	//top are the largest files, set only if the summary is requested
+	top []*node
+}
+
+// summarize makes a single post-order pass over the walked nodes: it totals directory sizes,
+// collects the largest files and then drops whatever was walked only to be counted
+func summarize(root *node, opts Options) *tree {
+	var files []*node
+	var visit func(dir *node, depth int)
+	visit = func(dir *node, depth int) {
+		var total int64
+		for _, child := range dir.Children {
+			if child.IsDir {
+				visit(child, depth+1)
+			} else {
+				files = append(files, child)
+			}
+			total += child.Size
+		}
+		if opts.DiskUsage {
+			dir.Size = total
+			dir.Total = true
+		}
+		if !opts.PrintFiles {
+			dir.Children = filter(dir.Children, func(el *node) bool {
+				return el.IsDir
+			})
+		}
+		if !opts.descend(depth) {
+			dir.Children = nil
+		}
+		if opts.SortBy == "size" {
+			sortBySize(dir.Children)
+		}
+	}
+	visit(root, 0)
+
+	t := &tree{root: root, human: opts.HumanSizes}
+	if opts.TopN > 0 {
+		sortBySize(files)
+		if len(files) > opts.TopN {
+			files = files[:opts.TopN]
+		}
+		t.top = files
+	}
+	return t
+}
+
+// sortBySize keeps the name order for entries of the same size
+func sortBySize(nodes []*node) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Size > nodes[j].Size
+	})
+}
+
+// sizeString is shared by all renderers so that they agree on sizes
+func sizeString(size int64, human bool) string {
+	if size == 0 {
+		return "empty"
+	}
+	if !human || size < 1024 {
+		return fmt.Sprintf("%db", size)
+	}
+	value := float64(size)
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	unit := ""
+	for _, unit = range units {
+		value /= 1024
+		if value < 1024 {
+			break
+		}
+	}
+	return fmt.Sprintf("%.1f%s", value, unit)
+}
+
+// fileString is the label of an entry, directories have a size only in the disk usage mode
+func fileString(file *node, human bool) string {
+	name := file.Name
+	if file.Link != "" {
+		name += " -> " + file.Link
+	}
+	switch {
+	case file.Broken:
+		return name + " [broken]"
+	case file.Loop:
+		return name + " [loop]"
+	case file.IsDir && !file.Total:
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, sizeString(file.Size, human))
+}
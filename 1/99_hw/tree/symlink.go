@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// linkEntry is a followed symlink, it looks like its target except for the name
+type linkEntry struct {
+	os.DirEntry
+	target string
+	info   fs.FileInfo
+	broken bool
+}
+
+func (e *linkEntry) IsDir() bool {
+	return !e.broken && e.info.IsDir()
+}
+
+func (e *linkEntry) Type() fs.FileMode {
+	if e.broken {
+		return e.DirEntry.Type()
+	}
+	return e.info.Mode().Type()
+}
+
+func (e *linkEntry) Info() (fs.FileInfo, error) {
+	if e.broken {
+		return e.DirEntry.Info()
+	}
+	return e.info, nil
+}
+
+// resolveLinks replaces symlinks in the directory at path with their targets
+func resolveLinks(path string, files []os.DirEntry) []os.DirEntry {
+	for i, file := range files {
+		if file.Type()&fs.ModeSymlink == 0 {
+			continue
+		}
+		full := filepath.Join(path, file.Name())
+		target, err := os.Readlink(full)
+		if err != nil {
+			//not a link anymore, it will be stated as is
+			continue
+		}
+		link := &linkEntry{DirEntry: file, target: target}
+		link.info, err = os.Stat(full)
+		link.broken = err != nil
+		files[i] = link
+	}
+	return files
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// node is a walked file or directory, renderers get the whole tree at once
+type node struct {
+	Name  string
+	Rel   string
+	IsDir bool
+	Size  int64
+	//Total is set for directories which Size is the sum of their content
+	Total   bool
+	Mode    fs.FileMode
+	ModTime time.Time
+	//Link is the target of a followed symlink
+	Link string
+	//Broken is set for a followed symlink which target doesn't exist
+	Broken bool
+	//Loop is set for a directory that is already one of its own ancestors, it's not walked
+	Loop     bool
+	Children []*node
+}
+
+func newNode(info fs.FileInfo, rel string) *node {
+	return &node{
+		Name:    info.Name(),
+		Rel:     rel,
+		IsDir:   info.IsDir(),
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+	}
+}
+
+// entryNode stats the entry, for a followed symlink it's the target that is stated
+func entryNode(file os.DirEntry, rel string) (*node, fs.FileInfo, error) {
+	info, err := file.Info()
+	if err != nil {
+		return nil, nil, err
+	}
+	n := newNode(info, rel)
+	if link, ok := file.(*linkEntry); ok {
+		n.Link = link.target
+		if link.broken {
+			n.Broken = true
+			n.Size = 0
+		}
+	}
+	return n, info, nil
+}
+
+// level is the state of the walk passed down to the nested directories
+type level struct {
+	rel     string
+	depth   int
+	ignores []*gitignore
+	//ancestors are identities of the directories above, used to find loops when symlinks are followed
+	ancestors []fileID
+}
+
+func (lvl level) child(name string) level {
+	return level{
+		rel:       joinRel(lvl.rel, name),
+		depth:     lvl.depth + 1,
+		ignores:   lvl.ignores,
+		ancestors: lvl.ancestors,
+	}
+}
+
+func rootLevel(opts Options, info fs.FileInfo) level {
+	var lvl level
+	if id, ok := getFileID(info); ok && opts.FollowSymlinks {
+		lvl.ancestors = []fileID{id}
+	}
+	return lvl
+}
+
+// enter returns the level of a child directory and whether the directory has to be walked,
+// a directory met again among its ancestors is marked as a loop instead
+func (lvl level) enter(opts Options, dir *node, info fs.FileInfo) (level, bool) {
+	next := lvl.child(dir.Name)
+	if !opts.descend(next.depth) && !opts.walkAll() {
+		return next, false
+	}
+	if !opts.FollowSymlinks {
+		return next, true
+	}
+	id, ok := getFileID(info)
+	if !ok {
+		return next, true
+	}
+	for _, ancestor := range lvl.ancestors {
+		if ancestor == id {
+			dir.Loop = true
+			return next, false
+		}
+	}
+	next.ancestors = append(lvl.ancestors[:len(lvl.ancestors):len(lvl.ancestors)], id)
+	return next, true
+}
+
+func walkTree(ctx context.Context, path string, opts Options) (*node, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	root := newNode(info, "")
+	lvl := rootLevel(opts, info)
+	if opts.Workers > 1 {
+		err = walkConcurrent(ctx, path, opts, lvl, root)
+	} else {
+		err = dirTreeRecursive(ctx, path, opts, lvl, root)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// readLevel reads the directory and filters its entries, updating the .gitignore stack of the level
+func readLevel(path string, opts Options, lvl *level) ([]os.DirEntry, error) {
+	files, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	if opts.RespectGitignore {
+		gi, err := readGitignore(filepath.Join(path, ".gitignore"), lvl.rel)
+		if err != nil {
+			return nil, err
+		}
+		if gi != nil {
+			//full slice expression so that siblings don't overwrite each other's stack
+			lvl.ignores = append(lvl.ignores[:len(lvl.ignores):len(lvl.ignores)], gi)
+		}
+	}
+	if opts.FollowSymlinks {
+		//links are resolved before filtering, so that linked directories are filtered as directories
+		files = resolveLinks(path, files)
+	}
+	//need to filter before rendering because renderers handle last element differently
+	//if we not filter may come problem that last element is file & prinfiles is disabled
+	//or it is excluded by options, so this file actually is not last as we don't need to print it
+	return filter(files, func(el os.DirEntry) bool {
+		return opts.keep(el, joinRel(lvl.rel, el.Name()), lvl.ignores)
+	}), nil
+}
+
+// dirTreeRecursive is the sequential walker, it reads and stats entries one after another
+func dirTreeRecursive(ctx context.Context, path string, opts Options, lvl level, parent *node) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	files, err := readLevel(path, opts, &lvl)
+	if err != nil {
+		return err
+	}
+
+	parent.Children = make([]*node, 0, len(files))
+	for _, file := range files {
+		child, info, err := entryNode(file, joinRel(lvl.rel, file.Name()))
+		if err != nil {
+			return err
+		}
+		parent.Children = append(parent.Children, child)
+		if !file.IsDir() {
+			continue
+		}
+		next, ok := lvl.enter(opts, child, info)
+		if !ok {
+			continue
+		}
+		if err := dirTreeRecursive(ctx, path+"/"+file.Name(), opts, next, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+)
+
+// concurrentWalker reads directories and stats entries in parallel,
+// at most cap(slots) filesystem calls are in flight at the same time.
+// Every node is written into the slot of its index, so the order is the same as in the sequential walker
+type concurrentWalker struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	opts   Options
+	slots  chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+}
+
+func walkConcurrent(ctx context.Context, path string, opts Options, lvl level, root *node) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := &concurrentWalker{
+		ctx:    ctx,
+		cancel: cancel,
+		opts:   opts,
+		slots:  make(chan struct{}, opts.Workers),
+	}
+	w.wg.Add(1)
+	go w.walkDir(path, lvl, root)
+	w.wg.Wait()
+	if w.err != nil {
+		return w.err
+	}
+	return ctx.Err()
+}
+
+// acquire returns false if the walk was cancelled while waiting for a free slot.
+// A slot is held only during a filesystem call, never while waiting for children, so the walk can't deadlock
+func (w *concurrentWalker) acquire() bool {
+	select {
+	case w.slots <- struct{}{}:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+func (w *concurrentWalker) release() {
+	<-w.slots
+}
+
+// fail keeps the first error and stops everything else
+func (w *concurrentWalker) fail(err error) {
+	w.once.Do(func() {
+		w.err = err
+		w.cancel()
+	})
+}
+
+func (w *concurrentWalker) walkDir(path string, lvl level, parent *node) {
+	defer w.wg.Done()
+	if !w.acquire() {
+		return
+	}
+	files, err := readLevel(path, w.opts, &lvl)
+	w.release()
+	if err != nil {
+		w.fail(err)
+		return
+	}
+
+	parent.Children = make([]*node, len(files))
+	for i, file := range files {
+		if !w.acquire() {
+			return
+		}
+		w.wg.Add(1)
+		go w.statEntry(path, lvl, parent, i, file)
+	}
+}
+
+// statEntry is started with an acquired slot
+func (w *concurrentWalker) statEntry(path string, lvl level, parent *node, i int, file os.DirEntry) {
+	defer w.wg.Done()
+	child, info, err := entryNode(file, joinRel(lvl.rel, file.Name()))
+	w.release()
+	if err != nil {
+		w.fail(err)
+		return
+	}
+	parent.Children[i] = child
+	if !file.IsDir() {
+		return
+	}
+	next, ok := lvl.enter(w.opts, child, info)
+	if !ok {
+		return
+	}
+	w.wg.Add(1)
+	w.walkDir(path+"/"+file.Name(), next, child)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives stage events of a monitored pipeline, e.g. to pass them on to statsd
+type Metrics interface {
+	StageIn(pipeline, stage string, queueDepth int)
+	StageOut(pipeline, stage string, latency time.Duration)
+}
+
+// latencyBuckets are upper bounds of the latency histogram, the last bucket has no bound
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+type stageStats struct {
+	name  string
+	queue chan interface{}
+	//stageQueue is read by the stage instead of queue, it has the same capacity
+	stageQueue chan interface{}
+	in         uint64
+	out        uint64
+	//buckets has one more element for the latencies above the last bound
+	buckets    []uint64
+	latencySum int64
+	running    int32
+	//goroutines are the stage goroutine and the forwarding ones still running
+	goroutines int32
+
+	mu sync.Mutex
+	//entered are times values were taken by the stage and not yet answered, oldest first
+	entered []time.Time
+}
+
+// track counts a goroutine of the stage until the returned func is called
+func (s *stageStats) track() func() {
+	atomic.AddInt32(&s.goroutines, 1)
+	return func() { atomic.AddInt32(&s.goroutines, -1) }
+}
+
+// queueDepth is the number of values waiting for the stage in both queues
+func (s *stageStats) queueDepth() int {
+	return len(s.queue) + len(s.stageQueue)
+}
+
+func (s *stageStats) enter() {
+	atomic.AddUint64(&s.in, 1)
+	s.mu.Lock()
+	s.entered = append(s.entered, time.Now())
+	s.mu.Unlock()
+}
+
+// exit measures the latency from the oldest unanswered input, which is exact for stages keeping one output per input
+func (s *stageStats) exit() (time.Duration, bool) {
+	atomic.AddUint64(&s.out, 1)
+	s.mu.Lock()
+	if len(s.entered) == 0 {
+		s.mu.Unlock()
+		return 0, false
+	}
+	latency := time.Since(s.entered[0])
+	s.entered = s.entered[1:]
+	s.mu.Unlock()
+
+	i := 0
+	for i < len(latencyBuckets) && latency > latencyBuckets[i] {
+		i++
+	}
+	atomic.AddUint64(&s.buckets[i], 1)
+	atomic.AddInt64(&s.latencySum, int64(latency))
+	return latency, true
+}
+
+// Monitor collects per stage stats of the pipeline run with it, one run at a time.
+// It is an expvar.Var and an http.Handler dumping the live state
+type Monitor struct {
+	name    string
+	metrics Metrics
+
+	mu      sync.Mutex
+	stages  []*stageStats
+	started time.Time
+	running bool
+}
+
+// NewMonitor creates a monitor, metrics may be nil if expvar and the debug handler are enough
+func NewMonitor(name string, metrics Metrics) *Monitor {
+	return &Monitor{name: name, metrics: metrics}
+}
+
+type monitorKey struct{}
+
+// WithMonitor makes ExecutePipelineContext report to the monitor
+func WithMonitor(ctx context.Context, m *Monitor) context.Context {
+	return context.WithValue(ctx, monitorKey{}, m)
+}
+
+func monitorFromContext(ctx context.Context) *Monitor {
+	m, _ := ctx.Value(monitorKey{}).(*Monitor)
+	return m
+}
+
+// Publish exports the monitor with expvar as "pipeline_<name>", it panics if the name is taken just like expvar does
+func (m *Monitor) Publish() {
+	expvar.Publish("pipeline_"+m.name, m)
+}
+
+func (m *Monitor) start(queues []chan interface{}) []*stageStats {
+	stages := make([]*stageStats, len(queues))
+	for i := range stages {
+		stages[i] = &stageStats{
+			name:    "stage" + strconv.Itoa(i),
+			queue:   queues[i],
+			buckets: make([]uint64, len(latencyBuckets)+1),
+		}
+		if queues[i] != nil {
+			stages[i].stageQueue = make(chan interface{}, cap(queues[i]))
+		}
+	}
+	m.mu.Lock()
+	m.stages = stages
+	m.started = time.Now()
+	m.running = true
+	m.mu.Unlock()
+	return stages
+}
+
+func (m *Monitor) stop() {
+	m.mu.Lock()
+	m.running = false
+	m.mu.Unlock()
+}
+
+// wrap puts the stage between channels with the capacity of in and out, so the stage is buffered as without the monitor.
+// A value is counted when it's queued for the stage and when the stage gives it, the latency includes the time in the queue.
+// Forwarding goroutines are added to wg and end after in and stageOut are closed
+func (m *Monitor) wrap(s *stageStats, in, out chan interface{}, wg *sync.WaitGroup) (stageIn, stageOut chan interface{}) {
+	if in != nil {
+		stageIn = s.stageQueue
+		wg.Add(1)
+		done := s.track()
+		go func() {
+			defer wg.Done()
+			defer done()
+			defer close(stageIn)
+			for data := range in {
+				stageIn <- data
+				s.enter()
+				if m.metrics != nil {
+					m.metrics.StageIn(m.name, s.name, s.queueDepth())
+				}
+			}
+		}()
+	}
+	stageOut = make(chan interface{}, cap(out))
+	wg.Add(1)
+	done := s.track()
+	go func() {
+		defer wg.Done()
+		defer done()
+		defer close(out)
+		for data := range stageOut {
+			latency, ok := s.exit()
+			if ok && m.metrics != nil {
+				m.metrics.StageOut(m.name, s.name, latency)
+			}
+			out <- data
+		}
+	}()
+	return stageIn, stageOut
+}
+
+// run counts the stage goroutine and labels it and the goroutines it starts, so that they can be told apart in profiles
+func (m *Monitor) run(ctx context.Context, s *stageStats, f func(ctx context.Context)) {
+	defer s.track()()
+	atomic.StoreInt32(&s.running, 1)
+	defer atomic.StoreInt32(&s.running, 0)
+	pprof.Do(ctx, pprof.Labels("pipeline", m.name, "stage", s.name), f)
+}
+
+type BucketSnapshot struct {
+	LessOrEqual string `json:"le"`
+	Count       uint64 `json:"count"`
+}
+
+type StageSnapshot struct {
+	Name       string `json:"name"`
+	Running    bool   `json:"running"`
+	In         uint64 `json:"in"`
+	Out        uint64 `json:"out"`
+	QueueDepth int    `json:"queue_depth"`
+	//Goroutines are the stage goroutine and the forwarding ones, not the goroutines the stage starts itself
+	Goroutines int              `json:"goroutines"`
+	LatencyAvg string           `json:"latency_avg"`
+	Latency    []BucketSnapshot `json:"latency"`
+}
+
+type PipelineSnapshot struct {
+	Name    string    `json:"name"`
+	Running bool      `json:"running"`
+	Started time.Time `json:"started"`
+	//Goroutines are the ones of all the stages, the other goroutines of the process are not counted
+	Goroutines int             `json:"goroutines"`
+	Stages     []StageSnapshot `json:"stages"`
+}
+
+func (m *Monitor) Snapshot() PipelineSnapshot {
+	m.mu.Lock()
+	snapshot := PipelineSnapshot{
+		Name:    m.name,
+		Running: m.running,
+		Started: m.started,
+	}
+	stages := m.stages
+	m.mu.Unlock()
+
+	for _, s := range stages {
+		stage := StageSnapshot{
+			Name:       s.name,
+			Running:    atomic.LoadInt32(&s.running) == 1,
+			In:         atomic.LoadUint64(&s.in),
+			Out:        atomic.LoadUint64(&s.out),
+			Goroutines: int(atomic.LoadInt32(&s.goroutines)),
+		}
+		stage.QueueDepth = s.queueDepth()
+		var count uint64
+		for i := range s.buckets {
+			bucket := BucketSnapshot{LessOrEqual: "+Inf", Count: atomic.LoadUint64(&s.buckets[i])}
+			if i < len(latencyBuckets) {
+				bucket.LessOrEqual = latencyBuckets[i].String()
+			}
+			count += bucket.Count
+			stage.Latency = append(stage.Latency, bucket)
+		}
+		if count > 0 {
+			stage.LatencyAvg = (time.Duration(atomic.LoadInt64(&s.latencySum)) / time.Duration(count)).String()
+		}
+		snapshot.Goroutines += stage.Goroutines
+		snapshot.Stages = append(snapshot.Stages, stage)
+	}
+	return snapshot
+}
+
+// String makes the monitor an expvar.Var
+func (m *Monitor) String() string {
+	data, err := json.Marshal(m.Snapshot())
+	if err != nil {
+		return strconv.Quote(err.Error())
+	}
+	return string(data)
+}
+
+// ServeHTTP dumps the live state of the pipeline, e.g. at /debug/pipeline
+func (m *Monitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := json.MarshalIndent(m.Snapshot(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintln(w, string(data))
+}
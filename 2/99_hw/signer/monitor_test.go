@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingMetrics struct {
+	mu   sync.Mutex
+	in   map[string]int
+	outs map[string]int
+}
+
+func (r *recordingMetrics) StageIn(pipeline, stage string, queueDepth int) {
+	r.mu.Lock()
+	r.in[stage]++
+	r.mu.Unlock()
+}
+
+func (r *recordingMetrics) StageOut(pipeline, stage string, latency time.Duration) {
+	r.mu.Lock()
+	r.outs[stage]++
+	r.mu.Unlock()
+}
+
+func TestPipelineMonitored(t *testing.T) {
+	metrics := &recordingMetrics{in: map[string]int{}, outs: map[string]int{}}
+	//expvar names can't be published twice, e.g. with -count
+	name := "test" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	monitor := NewMonitor(name, metrics)
+	//the second stage holds its first value and the first stage holds its output open until the live snapshot is taken
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	var capIn, capOut int
+	go func() {
+		defer close(finished)
+		ExecutePipelineMonitored(monitor,
+			job(func(in, out chan interface{}) {
+				for i := 0; i < 5; i++ {
+					out <- i
+				}
+				<-release
+			}),
+			job(func(in, out chan interface{}) {
+				capIn, capOut = cap(in), cap(out)
+				var wg sync.WaitGroup
+				first := true
+				for val := range in {
+					if first {
+						first = false
+						close(entered)
+						<-release
+					}
+					wg.Add(1)
+					go func(val int) {
+						defer wg.Done()
+						time.Sleep(20 * time.Millisecond)
+						out <- val * 2
+					}(val.(int))
+				}
+				wg.Wait()
+			}),
+			job(func(in, out chan interface{}) {
+				for range in {
+				}
+			}),
+		)
+	}()
+
+	<-entered
+	live := monitor.Snapshot()
+	close(release)
+	<-finished
+
+	//the stage goroutine and both forwarding ones: the input one waits for the first stage to close its output
+	//and the whole pipeline: 2 goroutines of the first stage without input and 3 of each other stage
+	if !live.Running || len(live.Stages) != 3 || !live.Stages[1].Running || live.Stages[1].Goroutines != 3 || live.Goroutines != 8 {
+		t.Errorf("unexpected live snapshot: %+v", live)
+	}
+
+	if capIn != MaxInputDataLen || capOut != MaxInputDataLen {
+		t.Errorf("stage channels have to be buffered as without the monitor, got capacity %d in and %d out", capIn, capOut)
+	}
+
+	snapshot := monitor.Snapshot()
+	if snapshot.Running {
+		t.Errorf("pipeline has to be finished")
+	}
+	expected := []struct{ in, out uint64 }{{0, 5}, {5, 5}, {5, 0}}
+	for i, stage := range snapshot.Stages {
+		if stage.In != expected[i].in || stage.Out != expected[i].out || stage.Goroutines != 0 {
+			t.Errorf("%s: got in %d out %d goroutines %d, expected %+v", stage.Name, stage.In, stage.Out, stage.Goroutines, expected[i])
+		}
+	}
+	latency := snapshot.Stages[1].Latency
+	if latency[2].LessOrEqual != "100ms" || latency[2].Count != 5 {
+		t.Errorf("expected 5 latencies between 10ms and 100ms, got %+v", latency)
+	}
+	if metrics.in["stage1"] != 5 || metrics.outs["stage1"] != 5 || metrics.in["stage2"] != 5 {
+		t.Errorf("unexpected metrics: in %v out %v", metrics.in, metrics.outs)
+	}
+
+	monitor.Publish()
+	if v := expvar.Get("pipeline_" + name); v == nil || v.String() != monitor.String() {
+		t.Errorf("monitor is not published with expvar")
+	}
+
+	recorder := httptest.NewRecorder()
+	monitor.ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/pipeline", nil))
+	var dumped PipelineSnapshot
+	if err := json.Unmarshal(recorder.Body.Bytes(), &dumped); err != nil || len(dumped.Stages) != 3 {
+		t.Errorf("unexpected debug dump %q: %v", recorder.Body.String(), err)
+	}
+}
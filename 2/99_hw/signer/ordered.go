@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+)
+
+// Backpressure is what OrderedMap does when the next stage doesn't keep up
+type Backpressure int
+
+const (
+	// Block stops taking new input until the next stage reads the results
+	Block Backpressure = iota
+	// DropOldest keeps computing and throws away the oldest result not yet read by the next stage
+	DropOldest
+)
+
+type OrderedOptions struct {
+	// MaxInFlight limits values taken from input and not yet passed on, 0 means MaxInputDataLen
+	MaxInFlight  int
+	Backpressure Backpressure
+	// OnDrop is called for every result thrown away under DropOldest
+	OnDrop func()
+}
+
+// OrderedMap applies f to several values at a time and passes results on in the input order
+func OrderedMap[In, Out any](opts OrderedOptions, f func(ctx context.Context, data In) (Out, error)) Stage[In, Out] {
+	limit := opts.MaxInFlight
+	if limit <= 0 {
+		limit = MaxInputDataLen
+	}
+	return func(ctx context.Context, in <-chan In, out chan<- Out) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		g := &errGroup{cancel: cancel}
+		slots := make(chan struct{}, limit)
+		//results are queued in the input order, every one is filled by its own goroutine
+		pending := make(chan chan Out, limit)
+
+		g.Go(func() error {
+			defer close(pending)
+			for data := range in {
+				if err := sendTo(ctx, slots, struct{}{}); err != nil {
+					return err
+				}
+				res := make(chan Out, 1)
+				pending <- res
+				data := data
+				g.Go(func() error {
+					v, err := f(ctx, data)
+					if err != nil {
+						return err
+					}
+					res <- v
+					return nil
+				})
+			}
+			return nil
+		})
+		g.Go(func() error {
+			if opts.Backpressure == DropOldest {
+				return writeDroppingOldest(ctx, pending, slots, out, limit, opts.OnDrop)
+			}
+			return writeBlocking(ctx, pending, slots, out)
+		})
+		if err := g.Wait(); err != nil {
+			return err
+		}
+		return ctx.Err()
+	}
+}
+
+// writeBlocking frees a slot only after the next stage took the result
+func writeBlocking[T any](ctx context.Context, pending <-chan chan T, slots <-chan struct{}, out chan<- T) error {
+	for res := range pending {
+		var v T
+		select {
+		case v = <-res:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err := sendTo(ctx, out, v); err != nil {
+			return err
+		}
+		<-slots
+	}
+	return nil
+}
+
+// writeDroppingOldest frees a slot as soon as the result is ready and keeps at most limit of them buffered
+func writeDroppingOldest[T any](ctx context.Context, pending <-chan chan T, slots <-chan struct{}, out chan<- T, limit int, onDrop func()) error {
+	var buffered []T
+	var current chan T
+	for {
+		if pending == nil && current == nil && len(buffered) == 0 {
+			return nil
+		}
+		//nil channels disable their cases
+		var sendCh chan<- T
+		var head T
+		if len(buffered) > 0 {
+			sendCh = out
+			head = buffered[0]
+		}
+		var pendingCh <-chan chan T
+		if current == nil {
+			pendingCh = pending
+		}
+
+		select {
+		case sendCh <- head:
+			buffered = buffered[1:]
+		case res, ok := <-pendingCh:
+			if !ok {
+				pending = nil
+				continue
+			}
+			current = res
+		case v := <-current:
+			current = nil
+			<-slots
+			if len(buffered) == limit {
+				buffered = buffered[1:]
+				if onDrop != nil {
+					onDrop()
+				}
+			}
+			buffered = append(buffered, v)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPipelineContextError(t *testing.T) {
+	errStage := errors.New("stage failed")
+	var produced, collected int
+	start := time.Now()
+	err := ExecutePipelineContext(context.Background(),
+		func(ctx context.Context, in, out chan interface{}) error {
+			for i := 0; ; i++ {
+				if err := sendTo[interface{}](ctx, out, i); err != nil {
+					return err
+				}
+				produced++
+			}
+		},
+		func(ctx context.Context, in, out chan interface{}) error {
+			for data := range in {
+				if data.(int) == 10 {
+					return errStage
+				}
+				if err := sendTo[interface{}](ctx, out, data); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		func(ctx context.Context, in, out chan interface{}) error {
+			for range in {
+				collected++
+			}
+			return nil
+		},
+	)
+	if !errors.Is(err, errStage) {
+		t.Errorf("expected the stage error, got %v", err)
+	}
+	if collected != 10 {
+		t.Errorf("expected 10 collected values, got %d", collected)
+	}
+	if produced == 0 || time.Since(start) > time.Second {
+		t.Errorf("infinite producer has to be cancelled, produced %d", produced)
+	}
+}
+
+func TestPipelineContextBadType(t *testing.T) {
+	err := ExecutePipelineContext(context.Background(),
+		func(ctx context.Context, in, out chan interface{}) error {
+			return sendTo[interface{}](ctx, out, "not an int")
+		},
+		SingleHashContext,
+		MultiHashContext,
+		CombineResultsContext,
+	)
+	if err == nil || err.Error() != "SingleHash: expected int, got string" {
+		t.Errorf("expected type error from SingleHash, got %v", err)
+	}
+}
+
+func TestPipelineContextCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := ExecutePipelineContext(ctx,
+		func(ctx context.Context, in, out chan interface{}) error {
+			for {
+				if err := sendTo[interface{}](ctx, out, 1); err != nil {
+					return err
+				}
+			}
+		},
+		func(ctx context.Context, in, out chan interface{}) error {
+			for range in {
+			}
+			return nil
+		},
+	)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if end := time.Since(start); end > time.Second {
+		t.Errorf("cancellation took too long: %s", end)
+	}
+}
+
+func TestStageChain(t *testing.T) {
+	signers := Signers{Md5: Md5Signer{}, Crc32: Crc32Signer{}}
+	signer := Chain(Chain(SingleHashStage(hashStageOptions, signers), MultiHashStage(hashStageOptions, signers)), CombineResultsStage())
+	result, err := Collect(context.Background(), signer, 0, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542"
+	if len(result) != 1 || result[0] != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+func TestStageParallelMap(t *testing.T) {
+	var inFlight, maxInFlight int32
+	square := ParallelMap(3, func(ctx context.Context, data int) (int, error) {
+		current := atomic.AddInt32(&inFlight, 1)
+		for {
+			seen := atomic.LoadInt32(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		return data * data, nil
+	})
+	result, err := Collect(context.Background(), square, 1, 2, 3, 4, 5, 6, 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Ints(result)
+	if fmt.Sprint(result) != "[1 4 9 16 25 36 49]" {
+		t.Errorf("unexpected results %v", result)
+	}
+	if maxInFlight > 3 {
+		t.Errorf("expected at most 3 values in flight, got %d", maxInFlight)
+	}
+}
+
+func TestStageFanOutError(t *testing.T) {
+	errOdd := errors.New("odd value")
+	stage := FanOut(4, Map(func(ctx context.Context, data int) (int, error) {
+		if data%2 == 1 {
+			return 0, errOdd
+		}
+		return data, nil
+	}))
+	_, err := Collect(context.Background(), stage, 2, 4, 5, 6)
+	if !errors.Is(err, errOdd) {
+		t.Errorf("expected the stage error, got %v", err)
+	}
+}
+
+func TestOrderedMap(t *testing.T) {
+	var inFlight, maxInFlight int32
+	slowFirst := OrderedMap(OrderedOptions{MaxInFlight: 3}, func(ctx context.Context, data int) (int, error) {
+		current := atomic.AddInt32(&inFlight, 1)
+		for {
+			seen := atomic.LoadInt32(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(10-data) * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		return data * 10, nil
+	})
+	result, err := Collect(context.Background(), slowFirst, 1, 2, 3, 4, 5, 6, 7, 8, 9)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(result) != "[10 20 30 40 50 60 70 80 90]" {
+		t.Errorf("results are not in the input order: %v", result)
+	}
+	if maxInFlight > 3 {
+		t.Errorf("expected at most 3 values in flight, got %d", maxInFlight)
+	}
+}
+
+func TestOrderedMapDropOldest(t *testing.T) {
+	var dropped int32
+	opts := OrderedOptions{
+		MaxInFlight:  2,
+		Backpressure: DropOldest,
+		OnDrop: func() {
+			atomic.AddInt32(&dropped, 1)
+		},
+	}
+	identity := OrderedMap(opts, func(ctx context.Context, data int) (int, error) {
+		return data, nil
+	})
+	in := make(chan int)
+	out := make(chan int)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- identity(context.Background(), in, out)
+		close(out)
+	}()
+	//nobody reads out while the input is sent, so only the last 2 results survive
+	for i := 1; i <= 6; i++ {
+		in <- i
+	}
+	close(in)
+	for atomic.LoadInt32(&dropped) < 4 {
+		time.Sleep(time.Millisecond)
+	}
+	var result []int
+	for v := range out {
+		result = append(result, v)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(result) != "[5 6]" {
+		t.Errorf("expected the newest results, got %v", result)
+	}
+}
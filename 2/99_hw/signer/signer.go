@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strconv"
@@ -8,118 +9,231 @@ import (
 	"sync"
 )
 
+// contextJob is a pipeline stage that stops when ctx is done and can fail the whole pipeline
+type contextJob func(ctx context.Context, in, out chan interface{}) error
+
 func ExecutePipeline(hashSignJobs ...job) {
+	_ = ExecutePipelineContext(context.Background(), contextJobs(hashSignJobs)...)
+}
+
+// ExecutePipelineMonitored is ExecutePipeline reporting stats of every stage to the monitor
+func ExecutePipelineMonitored(monitor *Monitor, hashSignJobs ...job) {
+	_ = ExecutePipelineContext(WithMonitor(context.Background(), monitor), contextJobs(hashSignJobs)...)
+}
+
+func contextJobs(hashSignJobs []job) []contextJob {
+	result := make([]contextJob, 0, len(hashSignJobs))
+	for _, j := range hashSignJobs {
+		j := j
+		result = append(result, func(_ context.Context, in, out chan interface{}) error {
+			j(in, out)
+			return nil
+		})
+	}
+	return result
+}
+
+// ExecutePipelineContext cancels every stage as soon as one of them fails and returns the first error.
+// It waits for all stages to return, so nothing is left running after it.
+// Stages are monitored if the context carries a monitor, see WithMonitor
+func ExecutePipelineContext(ctx context.Context, hashSignJobs ...contextJob) error {
 	if len(hashSignJobs) == 0 {
-		return
+		return nil
 	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	var wg sync.WaitGroup
 	wg.Add(len(hashSignJobs))
+	var errOnce sync.Once
+	var firstErr error
 
 	chans := make([]chan interface{}, len(hashSignJobs)+1)
 	for i := 1; i < len(chans); i++ {
 		chans[i] = make(chan interface{}, MaxInputDataLen)
 	}
 
+	monitor := monitorFromContext(ctx)
+	var stages []*stageStats
+	if monitor != nil {
+		stages = monitor.start(chans[:len(chans)-1])
+		defer monitor.stop()
+	}
+
 	for i := 0; i < len(chans)-1; i++ {
+		in, out := chans[i], chans[i+1]
+		if monitor != nil {
+			in, out = monitor.wrap(stages[i], in, out, &wg)
+		}
 		go func(i int, in, out chan interface{}) {
-			hashSignJobs[i](in, out)
+			defer wg.Done()
+			var err error
+			if monitor != nil {
+				monitor.run(ctx, stages[i], func(ctx context.Context) {
+					err = hashSignJobs[i](ctx, in, out)
+				})
+			} else {
+				err = hashSignJobs[i](ctx, in, out)
+			}
 			close(out)
-			wg.Done()
-		}(i, chans[i], chans[i+1])
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+			//stage may return before its input is closed, drain it so that the previous stage isn't stuck on send
+			if in != nil {
+				for range in {
+				}
+			}
+		}(i, in, out)
 	}
 
 	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
 }
 
 func SingleHash(in chan interface{}, out chan interface{}) {
-	var wg sync.WaitGroup
-	var md5Mu sync.Mutex
+	SingleHashWith(defaultSigners())(in, out)
+}
 
-	for data := range in {
-		intData, ok := (data).(int)
-		if !ok {
-			return
+// SingleHashWith is SingleHash computing the hashes with the signers, e.g. with other limits
+func SingleHashWith(signers Signers) job {
+	return func(in, out chan interface{}) {
+		if err := singleHash(context.Background(), signers, in, out); err != nil {
+			fmt.Println(err)
 		}
+	}
+}
+
+func SingleHashContext(ctx context.Context, in chan interface{}, out chan interface{}) error {
+	return singleHash(ctx, defaultSigners(), in, out)
+}
+
+func singleHash(ctx context.Context, signers Signers, in chan interface{}, out chan interface{}) error {
+	if err := SingleHashStage(hashStageOptions, signers).job()(ctx, in, out); err != nil {
+		return fmt.Errorf("SingleHash: %w", err)
+	}
+	return nil
+}
+
+// hashStageOptions lets all values of the task be hashed at once, the order of results is kept
+var hashStageOptions = OrderedOptions{MaxInFlight: MaxInputDataLen}
+
+// SingleHashStage computes crc32(data)+"~"+crc32(md5(data)) for several values at a time,
+// limits such as the md5 overheat are up to the signers
+func SingleHashStage(opts OrderedOptions, signers Signers) Stage[int, string] {
+	return OrderedMap(opts, func(ctx context.Context, intData int) (string, error) {
 		strData := strconv.Itoa(intData)
 		fmt.Printf("%s SingleHash data %s\n", strData, strData)
 
-		wg.Add(1)
-		go func() {
-			md5 := make(chan string)
-			go func() {
-				md5Mu.Lock()
-				md5 <- DataSignerMd5(strData)
-				md5Mu.Unlock()
-			}()
-
-			crc32 := make(chan string)
-			go func() {
-				crc32 <- DataSignerCrc32(strData)
-			}()
-
-			crc32Md5 := make(chan string)
-			go func() {
-				md5Res := <-md5
-				fmt.Printf("%s SingleHash md5(data) %s\n", strData, md5Res)
-				crc32Md5 <- DataSignerCrc32(md5Res)
-			}()
-
-			crc32Res := <-crc32
-			fmt.Printf("%s SingleHash crc32(data) %s\n", strData, crc32Res)
-			crc32Md5Res := <-crc32Md5
-			fmt.Printf("%s SingleHash crc32(md5(data)) %s\n", strData, crc32Md5Res)
-			out <- crc32Res + "~" + crc32Md5Res
-
-			wg.Done()
-		}()
-	}
-	wg.Wait()
+		var g errGroup
+		var crc32Res, crc32Md5Res string
+		g.Go(func() error {
+			var err error
+			crc32Res, err = signers.Crc32.Sign(ctx, strData)
+			return err
+		})
+		g.Go(func() error {
+			md5Res, err := signers.Md5.Sign(ctx, strData)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s SingleHash md5(data) %s\n", strData, md5Res)
+			crc32Md5Res, err = signers.Crc32.Sign(ctx, md5Res)
+			return err
+		})
+		if err := g.Wait(); err != nil {
+			return "", err
+		}
+		fmt.Printf("%s SingleHash crc32(data) %s\n", strData, crc32Res)
+		fmt.Printf("%s SingleHash crc32(md5(data)) %s\n", strData, crc32Md5Res)
+		return crc32Res + "~" + crc32Md5Res, nil
+	})
 }
 
 func MultiHash(in chan interface{}, out chan interface{}) {
-	var wg sync.WaitGroup
-	for data := range in {
-		strData, ok := (data).(string)
-		if !ok {
-			return
+	MultiHashWith(defaultSigners())(in, out)
+}
+
+// MultiHashWith is MultiHash computing the hashes with the signers
+func MultiHashWith(signers Signers) job {
+	return func(in, out chan interface{}) {
+		if err := multiHash(context.Background(), signers, in, out); err != nil {
+			fmt.Println(err)
 		}
+	}
+}
 
-		wg.Add(1)
-
-		go func() {
-			hashes := make([]string, 6)
-			var wgHashes sync.WaitGroup
-			wgHashes.Add(6)
-			for i := 0; i < 6; i++ {
-				go func(i int) {
-					hashes[i] = DataSignerCrc32(strconv.Itoa(i) + strData)
-					fmt.Printf("%s MultiHash crc32(th+step1) %d %s\n", strData, i, hashes[i])
-					wgHashes.Done()
-				}(i)
-			}
+func MultiHashContext(ctx context.Context, in chan interface{}, out chan interface{}) error {
+	return multiHash(ctx, defaultSigners(), in, out)
+}
 
-			wgHashes.Wait()
-			res := strings.Join(hashes, "")
-			fmt.Printf("%s MultiHash result %s\n", strData, res)
-			out <- res
-			wg.Done()
-		}()
+func multiHash(ctx context.Context, signers Signers, in chan interface{}, out chan interface{}) error {
+	if err := MultiHashStage(hashStageOptions, signers).job()(ctx, in, out); err != nil {
+		return fmt.Errorf("MultiHash: %w", err)
 	}
-	wg.Wait()
+	return nil
+}
+
+// MultiHashStage concatenates crc32(th+data) for th from 0 to 5 for several values at a time
+func MultiHashStage(opts OrderedOptions, signers Signers) Stage[string, string] {
+	return OrderedMap(opts, func(ctx context.Context, strData string) (string, error) {
+		hashes := make([]string, 6)
+		var g errGroup
+		for i := 0; i < 6; i++ {
+			i := i
+			g.Go(func() error {
+				var err error
+				hashes[i], err = signers.Crc32.Sign(ctx, strconv.Itoa(i)+strData)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s MultiHash crc32(th+step1) %d %s\n", strData, i, hashes[i])
+				return nil
+			})
+		}
+
+		if err := g.Wait(); err != nil {
+			return "", err
+		}
+		res := strings.Join(hashes, "")
+		fmt.Printf("%s MultiHash result %s\n", strData, res)
+		return res, nil
+	})
 }
 
 func CombineResults(in chan interface{}, out chan interface{}) {
-	var data []string
-	for dataEl := range in {
-		strDataEl, ok := (dataEl).(string)
-		if !ok {
-			return
+	if err := CombineResultsContext(context.Background(), in, out); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func CombineResultsContext(ctx context.Context, in chan interface{}, out chan interface{}) error {
+	if err := CombineResultsStage().job()(ctx, in, out); err != nil {
+		return fmt.Errorf("CombineResults: %w", err)
+	}
+	return nil
+}
+
+// CombineResultsStage waits for all values and joins them sorted with "_",
+// the previous stages keep the input order, sorting is what the task asks for
+func CombineResultsStage() Stage[string, string] {
+	return func(ctx context.Context, in <-chan string, out chan<- string) error {
+		var data []string
+		for dataEl := range in {
+			data = append(data, dataEl)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
 		}
-		data = append(data, strDataEl)
+		sort.Strings(data)
+		res := strings.Join(data, "_")
+		fmt.Printf("CombineResults %s\n", res)
+		return sendTo(ctx, out, res)
 	}
-	sort.Strings(data)
-	res := strings.Join(data, "_")
-	fmt.Printf("CombineResults %s\n", res)
-	out <- res
 }
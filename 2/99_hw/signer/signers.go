@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// Signer is a hash function used by the pipeline stages
+type Signer interface {
+	Sign(ctx context.Context, data string) (string, error)
+}
+
+type SignerFunc func(ctx context.Context, data string) (string, error)
+
+func (f SignerFunc) Sign(ctx context.Context, data string) (string, error) {
+	return f(ctx, data)
+}
+
+// Signers are the hash functions SingleHash and MultiHash are computed with
+type Signers struct {
+	Md5   Signer
+	Crc32 Signer
+}
+
+// md5Bucket limits the calls of DataSignerMd5 to the rate it can do one by one, a call takes 10ms.
+// It's shared by all pipelines, as the overheat is
+var md5Bucket = NewTokenBucket(100, 1)
+
+// defaultSigners call DataSignerMd5 and DataSignerCrc32 at the moment of signing, so they can be substituted.
+// DataSignerMd5 overheats if two calls overlap, so they are exclusive, the bucket only spaces their starts
+func defaultSigners() Signers {
+	return Signers{
+		Md5: RateLimited(Exclusive(SignerFunc(func(_ context.Context, data string) (string, error) {
+			return DataSignerMd5(data), nil
+		})), md5Bucket),
+		Crc32: SignerFunc(func(_ context.Context, data string) (string, error) {
+			return DataSignerCrc32(data), nil
+		}),
+	}
+}
+
+type Md5Signer struct {
+	Salt string
+}
+
+func (s Md5Signer) Sign(_ context.Context, data string) (string, error) {
+	return fmt.Sprintf("%x", md5.Sum([]byte(data+s.Salt))), nil
+}
+
+type Crc32Signer struct {
+	Salt string
+}
+
+func (s Crc32Signer) Sign(_ context.Context, data string) (string, error) {
+	return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data+s.Salt))), 10), nil
+}
+
+type Sha256Signer struct {
+	Salt string
+}
+
+func (s Sha256Signer) Sign(_ context.Context, data string) (string, error) {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(data+s.Salt))), nil
+}
+
+type XXHashSigner struct {
+	Salt string
+}
+
+func (s XXHashSigner) Sign(_ context.Context, data string) (string, error) {
+	return strconv.FormatUint(xxhash.Sum64String(data+s.Salt), 10), nil
+}
+
+// NewSigner returns the provider by its name: md5, crc32, sha256 or xxhash
+func NewSigner(name string, salt string) (Signer, error) {
+	switch name {
+	case "md5":
+		return Md5Signer{Salt: salt}, nil
+	case "crc32":
+		return Crc32Signer{Salt: salt}, nil
+	case "sha256":
+		return Sha256Signer{Salt: salt}, nil
+	case "xxhash":
+		return XXHashSigner{Salt: salt}, nil
+	}
+	return nil, fmt.Errorf("unknown signer %q", name)
+}
+
+// Exclusive lets only one call of the signer run at a time
+func Exclusive(signer Signer) Signer {
+	var mu sync.Mutex
+	return SignerFunc(func(ctx context.Context, data string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return signer.Sign(ctx, data)
+	})
+}
+
+// TokenBucket allows burst calls at once and then rate calls per second
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait takes a token, waiting for it to be refilled if there is none
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// RateLimited waits for a token of the bucket before every call of the signer
+func RateLimited(signer Signer, bucket *TokenBucket) Signer {
+	return SignerFunc(func(ctx context.Context, data string) (string, error) {
+		if err := bucket.Wait(ctx); err != nil {
+			return "", err
+		}
+		return signer.Sign(ctx, data)
+	})
+}
+
+type cacheEntry struct {
+	done chan struct{}
+	hash string
+	err  error
+}
+
+// CachedSigner remembers results per input, concurrent calls with the same input wait for the first one
+type CachedSigner struct {
+	signer  Signer
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+func Cached(signer Signer) *CachedSigner {
+	return &CachedSigner{
+		signer:  signer,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+func (c *CachedSigner) Sign(ctx context.Context, data string) (string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[data]
+	if !ok {
+		entry = &cacheEntry{done: make(chan struct{})}
+		c.entries[data] = entry
+		c.mu.Unlock()
+		entry.hash, entry.err = c.signer.Sign(ctx, data)
+		if entry.err != nil {
+			//errors are not remembered, the next call tries again
+			c.mu.Lock()
+			delete(c.entries, data)
+			c.mu.Unlock()
+		}
+		close(entry.done)
+		return entry.hash, entry.err
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-entry.done:
+		return entry.hash, entry.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSignerProviders(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected string
+	}{
+		{"md5", "cfcd208495d565ef66e7dff9f98764da"},
+		{"crc32", "4108050209"},
+		{"sha256", "5feceb66ffc86f38d952786c6d696c79c2dbc239dd4e91b46729d73a27fb57e9"},
+		{"xxhash", "7148434200721666028"},
+	}
+	for _, c := range cases {
+		signer, err := NewSigner(c.name, "")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+		hash, err := signer.Sign(context.Background(), "0")
+		if err != nil || hash != c.expected {
+			t.Errorf("%s: got %q (%v), expected %q", c.name, hash, err, c.expected)
+		}
+	}
+	if _, err := NewSigner("md4", ""); err == nil {
+		t.Errorf("expected error for unknown signer")
+	}
+}
+
+func TestSignerRateLimited(t *testing.T) {
+	signer := RateLimited(Crc32Signer{}, NewTokenBucket(100, 1))
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := signer.Sign(context.Background(), "0"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	//the first token is there from the start, then one every 10ms
+	if end := time.Since(start); end < 40*time.Millisecond {
+		t.Errorf("rate limit is not respected: 5 calls took %s", end)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := signer.Sign(ctx, "0"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSignerCached(t *testing.T) {
+	var calls int32
+	slow := SignerFunc(func(ctx context.Context, data string) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return Md5Signer{}.Sign(ctx, data)
+	})
+	signer := Cached(slow)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if hash, err := signer.Sign(context.Background(), "0"); err != nil || hash != "cfcd208495d565ef66e7dff9f98764da" {
+				t.Errorf("unexpected result %q (%v)", hash, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("expected one call of the signer, got %d", calls)
+	}
+}
+
+func TestSignerErrorFailsPipeline(t *testing.T) {
+	errSigner := errors.New("signer is down")
+	signers := Signers{
+		Md5: Md5Signer{},
+		Crc32: SignerFunc(func(ctx context.Context, data string) (string, error) {
+			return "", errSigner
+		}),
+	}
+	_, err := Collect(context.Background(), SingleHashStage(hashStageOptions, signers), 0, 1, 2)
+	if !errors.Is(err, errSigner) {
+		t.Errorf("expected the signer error, got %v", err)
+	}
+}
+
+// TestDefaultSignersExclusive blocks every md5 call until the test releases it,
+// so the other calls are waiting for it while it runs. The pause only helps to catch an overlap,
+// the exclusive calls never overlap however the goroutines are scheduled
+func TestDefaultSignersExclusive(t *testing.T) {
+	var running, overlaps int32
+	entered, release := make(chan struct{}), make(chan struct{})
+	defer func(md5 func(string) string) { DataSignerMd5 = md5 }(DataSignerMd5)
+	DataSignerMd5 = func(data string) string {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		defer atomic.AddInt32(&running, -1)
+		entered <- struct{}{}
+		<-release
+		return data
+	}
+
+	signer := defaultSigners().Md5
+	const calls = 4
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := signer.Sign(context.Background(), "0"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	for i := 0; i < calls; i++ {
+		<-entered
+		if i == 0 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		release <- struct{}{}
+	}
+	wg.Wait()
+	if overlaps != 0 {
+		t.Errorf("md5 calls are not exclusive: %d overlaps", overlaps)
+	}
+}
+
+func TestSingleHashWith(t *testing.T) {
+	var calls int32
+	counted := func(signer Signer) Signer {
+		return SignerFunc(func(ctx context.Context, data string) (string, error) {
+			atomic.AddInt32(&calls, 1)
+			return signer.Sign(ctx, data)
+		})
+	}
+	signers := Signers{Md5: counted(Md5Signer{}), Crc32: counted(Crc32Signer{})}
+	var result string
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			out <- 0
+		}),
+		SingleHashWith(signers),
+		job(func(in, out chan interface{}) {
+			result = (<-in).(string)
+		}),
+	)
+	if result != "4108050209~502633748" || calls != 3 {
+		t.Errorf("got %q with %d signer calls", result, calls)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Stage is a typed pipeline step, it reads in until it's closed and never closes out itself.
+// Stages are chained with Chain, so a mismatch between them is a compile error
+type Stage[In, Out any] func(ctx context.Context, in <-chan In, out chan<- Out) error
+
+// Chain runs both stages concurrently connected by a channel, the first error cancels both
+func Chain[A, B, C any](first Stage[A, B], second Stage[B, C]) Stage[A, C] {
+	return func(ctx context.Context, in <-chan A, out chan<- C) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		g := &errGroup{cancel: cancel}
+		mid := make(chan B, MaxInputDataLen)
+		g.Go(func() error {
+			defer close(mid)
+			return first(ctx, in, mid)
+		})
+		g.Go(func() error {
+			if err := second(ctx, mid, out); err != nil {
+				g.fail(err)
+			}
+			//second may return before mid is closed, drain it so that first isn't stuck on send
+			for range mid {
+			}
+			return nil
+		})
+		return g.Wait()
+	}
+}
+
+// Map applies f to every value one after another
+func Map[In, Out any](f func(ctx context.Context, data In) (Out, error)) Stage[In, Out] {
+	return func(ctx context.Context, in <-chan In, out chan<- Out) error {
+		for data := range in {
+			res, err := f(ctx, data)
+			if err != nil {
+				return err
+			}
+			if err := sendTo(ctx, out, res); err != nil {
+				return err
+			}
+		}
+		return ctx.Err()
+	}
+}
+
+// ParallelMap applies f to at most parallelism values at a time, or to all of them at once if parallelism is 0.
+// Results come out in the order they are ready
+func ParallelMap[In, Out any](parallelism int, f func(ctx context.Context, data In) (Out, error)) Stage[In, Out] {
+	if parallelism > 0 {
+		return FanOut(parallelism, Map(f))
+	}
+	return func(ctx context.Context, in <-chan In, out chan<- Out) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		g := &errGroup{cancel: cancel}
+		for data := range in {
+			if ctx.Err() != nil {
+				break
+			}
+			data := data
+			g.Go(func() error {
+				res, err := f(ctx, data)
+				if err != nil {
+					return err
+				}
+				return sendTo(ctx, out, res)
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+		return ctx.Err()
+	}
+}
+
+// FanOut runs parallelism copies of the stage reading the same input, their outputs are merged with FanIn
+func FanOut[In, Out any](parallelism int, stage Stage[In, Out]) Stage[In, Out] {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	return func(ctx context.Context, in <-chan In, out chan<- Out) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		g := &errGroup{cancel: cancel}
+		outs := make([]<-chan Out, 0, parallelism)
+		for i := 0; i < parallelism; i++ {
+			copyOut := make(chan Out)
+			outs = append(outs, copyOut)
+			g.Go(func() error {
+				defer close(copyOut)
+				return stage(ctx, in, copyOut)
+			})
+		}
+		g.Go(func() error {
+			return FanIn(ctx, out, outs...)
+		})
+		return g.Wait()
+	}
+}
+
+// FanIn forwards values from all ins to out until every one of them is closed
+func FanIn[T any](ctx context.Context, out chan<- T, ins ...<-chan T) error {
+	g := &errGroup{}
+	for _, in := range ins {
+		in := in
+		g.Go(func() error {
+			for data := range in {
+				if err := sendTo(ctx, out, data); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// Collect runs the stage over the values and gathers everything it outputs
+func Collect[In, Out any](ctx context.Context, stage Stage[In, Out], values ...In) ([]Out, error) {
+	in := make(chan In, len(values))
+	for _, data := range values {
+		in <- data
+	}
+	close(in)
+
+	out := make(chan Out, MaxInputDataLen)
+	var result []Out
+	done := make(chan struct{})
+	go func() {
+		for data := range out {
+			result = append(result, data)
+		}
+		close(done)
+	}()
+	err := stage(ctx, in, out)
+	close(out)
+	<-done
+	return result, err
+}
+
+// job converts the stage for the untyped pipeline, a value of a wrong type fails it
+func (s Stage[In, Out]) job() contextJob {
+	typed := Chain(Chain(fromUntyped[In](), s), toUntyped[Out]())
+	return func(ctx context.Context, in, out chan interface{}) error {
+		return typed(ctx, in, out)
+	}
+}
+
+func fromUntyped[T any]() Stage[interface{}, T] {
+	return Map(func(ctx context.Context, data interface{}) (T, error) {
+		typed, ok := data.(T)
+		if !ok {
+			return typed, fmt.Errorf("expected %s, got %T", reflect.TypeOf((*T)(nil)).Elem(), data)
+		}
+		return typed, nil
+	})
+}
+
+func toUntyped[T any]() Stage[T, interface{}] {
+	return Map(func(ctx context.Context, data T) (interface{}, error) {
+		return data, nil
+	})
+}
+
+// sendTo passes data to the next stage unless the pipeline is cancelled
+func sendTo[T any](ctx context.Context, out chan<- T, data T) error {
+	select {
+	case out <- data:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// errGroup keeps the first error of the goroutines started by a stage and cancels the rest if cancel is set
+type errGroup struct {
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+	cancel context.CancelFunc
+}
+
+func (g *errGroup) Go(f func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := f(); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+func (g *errGroup) fail(err error) {
+	g.once.Do(func() {
+		g.err = err
+		if g.cancel != nil {
+			g.cancel()
+		}
+	})
+}
+
+func (g *errGroup) Wait() error {
+	g.wg.Wait()
+	return g.err
+}
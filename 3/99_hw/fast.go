@@ -1,66 +1,51 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"fmt"
-	"github.com/mailru/easyjson"
+	"hw3/query"
 	"hw3/user"
 	"io"
 	"os"
-	"strings"
 )
 
 func FastSearch(out io.Writer) {
-	file, err := os.Open(filePath)
+	fastSearchFile(out, filePath, 1)
+}
+
+// FastSearchParallel decodes the file in workers chunks at once, the output is the same as of FastSearch
+func FastSearchParallel(out io.Writer, workers int) {
+	fastSearchFile(out, filePath, workers)
+}
+
+func fastSearchFile(out io.Writer, path string, workers int) {
+	file, err := os.Open(path)
 	if err != nil {
 		panic(err)
 	}
-	scanner := bufio.NewScanner(file)
-
-	seenBrowsers := map[string]bool{}
-	var foundUsersBuilder strings.Builder
+	defer file.Close()
 
-	for i := 0; scanner.Scan(); i++ {
-		var u user.User
-		// fmt.Printf("%v %v\n", err, line)
-		err := easyjson.Unmarshal(scanner.Bytes(), &u)
-		if err != nil {
+	if workers <= 1 {
+		if err := Search(context.Background(), file, out, SearchOptions{}); err != nil {
 			panic(err)
 		}
+		return
+	}
 
-		isAndroid := false
-		isMSIE := false
-
-		for _, browser := range u.Browsers {
-			if strings.Contains(browser, "Android") {
-				isAndroid = true
-				if _, seenBefore := seenBrowsers[browser]; !seenBefore {
-					// log.Printf("FAST New browser: %s, first seen: %s", browser, u.Name)
-					seenBrowsers[browser] = true
-				}
-			}
-
-			if strings.Contains(browser, "MSIE") {
-				isMSIE = true
-				if _, seenBefore := seenBrowsers[browser]; !seenBefore {
-					// log.Printf("FAST New browser: %s, first seen: %s", browser, u.Name)
-					seenBrowsers[browser] = true
-				}
-			}
-		}
-
-		if !(isAndroid && isMSIE) {
-			continue
-		}
-
-		// log.Println("Android and MSIE user:", u.Name, u.Email)
-		email := strings.ReplaceAll(u.Email, "@", " [at] ")
-		foundUsersBuilder.WriteString(fmt.Sprintf("[%d] %s <%s>\n", i, u.Name, email))
+	info, err := file.Stat()
+	if err != nil {
+		panic(err)
 	}
-	if err := scanner.Err(); err != nil {
+	//chunks are merged at the end, so found users can be written only after the whole file is read
+	q, browsers := searchQuery(SearchOptions{})
+	if _, err := fmt.Fprintln(out, "found users:"); err != nil {
 		panic(err)
 	}
-
-	fmt.Fprintln(out, "found users:\n"+foundUsersBuilder.String())
-	fmt.Fprintln(out, "Total unique browsers", len(seenBrowsers))
+	err = query.RunParallel(file, info.Size(), q, workers, func(i int, u *user.User) error {
+		return writeUser(out, i, u)
+	})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(out, "\nTotal unique browsers", browsers.Len())
 }
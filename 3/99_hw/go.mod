@@ -1,5 +1,10 @@
 module hw3
 
-go 1.16
+go 1.22
 
-require github.com/mailru/easyjson v0.7.7 // indirect
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/mailru/easyjson v0.7.7
+)
+
+require github.com/josharian/intern v1.0.0 // indirect
@@ -3,14 +3,23 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
+	"github.com/klauspost/compress/zstd"
 	"github.com/mailru/easyjson"
+	"hw3/query"
 	"hw3/user"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // запускаем перед основными функциями по разу чтобы файл остался в памяти в файловом кеше
@@ -167,3 +176,162 @@ func BenchmarkReplaceByStrings(b *testing.B) {
 		strings.ReplaceAll(email, replaceable, replacement)
 	}
 }
+
+func TestSearchParallel(t *testing.T) {
+	fastOut := new(bytes.Buffer)
+	FastSearch(fastOut)
+	fastResult := fastOut.String()
+
+	for _, workers := range []int{2, 3, 8, 1000} {
+		parallelOut := new(bytes.Buffer)
+		FastSearchParallel(parallelOut, workers)
+		if parallelResult := parallelOut.String(); parallelResult != fastResult {
+			t.Errorf("%d workers: results not match\nGot:\n%v\nExpected:\n%v", workers, parallelResult, fastResult)
+		}
+	}
+}
+
+// largeDataset repeats users.txt to get a multi-MB input
+func largeDataset(b *testing.B, times int) string {
+	b.Helper()
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	path := filepath.Join(b.TempDir(), "users.txt")
+	file, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+	for i := 0; i < times; i++ {
+		if i > 0 {
+			if _, err := file.WriteString("\n"); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if _, err := file.Write(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return path
+}
+
+func benchmarkLarge(b *testing.B, workers int) {
+	path := largeDataset(b, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fastSearchFile(ioutil.Discard, path, workers)
+	}
+}
+
+func BenchmarkFastLarge(b *testing.B) {
+	benchmarkLarge(b, 1)
+}
+
+func BenchmarkParallelLarge2(b *testing.B) {
+	benchmarkLarge(b, 2)
+}
+
+func BenchmarkParallelLarge4(b *testing.B) {
+	benchmarkLarge(b, 4)
+}
+
+func BenchmarkParallelLarge8(b *testing.B) {
+	benchmarkLarge(b, 8)
+}
+
+func TestSearchCompressed(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fastOut := new(bytes.Buffer)
+	FastSearch(fastOut)
+
+	gzipped := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(gzipped)
+	if _, err := gzipWriter.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zstdEncoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := map[string][]byte{
+		"plain": data,
+		"gzip":  gzipped.Bytes(),
+		"zstd":  zstdEncoder.EncodeAll(data, nil),
+	}
+	for name, input := range inputs {
+		out := new(bytes.Buffer)
+		if err := Search(context.Background(), bytes.NewReader(input), out, SearchOptions{}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if out.String() != fastOut.String() {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", name, out.String(), fastOut.String())
+		}
+	}
+}
+
+func TestSearchStreaming(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstLine := data[:bytes.IndexByte(data, '\n')+1]
+	reader, writer := io.Pipe()
+	out := newSyncBuffer()
+	errs := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		errs <- Search(ctx, reader, out, SearchOptions{Where: query.Where(query.Name, query.Prefix(""))})
+	}()
+
+	//the first user has to be written while the input is still open
+	if _, err := writer.Write(firstLine); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(firstLine); err != nil {
+		t.Fatal(err)
+	}
+	for !strings.Contains(out.String(), "[0] ") {
+		time.Sleep(time.Millisecond)
+	}
+
+	//the next line wakes the search up if it's waiting for input, it may stop before reading it
+	cancel()
+	go writer.Write(firstLine)
+	err = <-errs
+	writer.Close()
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if strings.Contains(out.String(), "Total unique browsers") {
+		t.Errorf("footer is written after cancellation:\n%v", out.String())
+	}
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func newSyncBuffer() *syncBuffer {
+	return &syncBuffer{}
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
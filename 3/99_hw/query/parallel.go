@@ -0,0 +1,114 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"hw3/user"
+)
+
+// chunk is a byte range of the input starting at a line start, with everything it found
+type chunk struct {
+	start, end   int64
+	lines        int
+	found        []foundUser
+	aggregations []Aggregation
+	err          error
+}
+
+type foundUser struct {
+	line int
+	user user.User
+}
+
+// RunParallel is Run over size bytes of r split into chunks aligned to lines, which are decoded by workers at once.
+// Line indexes are local to a chunk while scanning, so found is called only after all chunks are done,
+// in the same order and with the same indexes as Run would do
+func RunParallel(r io.ReaderAt, size int64, q Query, workers int, found func(i int, u *user.User) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	bounds, err := splitLines(r, size, workers)
+	if err != nil {
+		return err
+	}
+	chunks := make([]*chunk, len(bounds)-1)
+	var wg sync.WaitGroup
+	for k := range chunks {
+		c := &chunk{start: bounds[k], end: bounds[k+1]}
+		for _, a := range q.Aggregations {
+			c.aggregations = append(c.aggregations, a.Fork())
+		}
+		chunks[k] = c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.scan(r, q)
+		}()
+	}
+	wg.Wait()
+
+	first := 0
+	for _, c := range chunks {
+		if c.err != nil {
+			return c.err
+		}
+		for i, a := range q.Aggregations {
+			a.Merge(c.aggregations[i])
+		}
+		for _, f := range c.found {
+			if err := found(first+f.line, &f.user); err != nil {
+				return err
+			}
+		}
+		first += c.lines
+	}
+	return nil
+}
+
+func (c *chunk) scan(r io.ReaderAt, q Query) {
+	chunkQuery := Query{Where: q.Where, Aggregations: c.aggregations}
+	c.lines, c.err = scan(context.Background(), io.NewSectionReader(r, c.start, c.end-c.start), 0, chunkQuery, func(i int, u *user.User) error {
+		//the scanned user is reused, so the browsers are copied
+		f := foundUser{line: i, user: *u}
+		f.user.Browsers = append([]string(nil), u.Browsers...)
+		c.found = append(c.found, f)
+		return nil
+	})
+}
+
+// splitLines returns n+1 or fewer offsets, every chunk but the first starts right after a newline
+func splitLines(r io.ReaderAt, size int64, n int) ([]int64, error) {
+	bounds := []int64{0}
+	buf := make([]byte, 4096)
+	for k := 1; k < n; k++ {
+		offset := size * int64(k) / int64(n)
+		if last := bounds[len(bounds)-1]; offset <= last {
+			offset = last
+		}
+		//look for the end of the line the offset points into
+		for offset < size {
+			read, err := r.ReadAt(buf, offset)
+			if i := bytes.IndexByte(buf[:read], '\n'); i >= 0 {
+				offset += int64(i) + 1
+				break
+			}
+			offset += int64(read)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if offset >= size {
+			break
+		}
+		if offset > bounds[len(bounds)-1] {
+			bounds = append(bounds, offset)
+		}
+	}
+	return append(bounds, size), nil
+}
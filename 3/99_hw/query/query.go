@@ -0,0 +1,323 @@
+// Package query selects users from users.txt-like input with composable predicates
+// and computes count and unique aggregations in the same pass.
+package query
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mailru/easyjson"
+	"hw3/user"
+)
+
+type Field int
+
+const (
+	Browsers Field = iota
+	Company
+	Country
+	Email
+	Job
+	Name
+	Phone
+)
+
+var fieldNames = map[string]Field{
+	"browsers": Browsers,
+	"company":  Company,
+	"country":  Country,
+	"email":    Email,
+	"job":      Job,
+	"name":     Name,
+	"phone":    Phone,
+}
+
+// ParseField takes the json name of the field
+func ParseField(name string) (Field, error) {
+	f, ok := fieldNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown field %q", name)
+	}
+	return f, nil
+}
+
+// any reports whether the matcher accepts any value of the field, Browsers has several values
+func (f Field) any(u *user.User, m Matcher) bool {
+	switch f {
+	case Browsers:
+		for _, browser := range u.Browsers {
+			if m.MatchString(browser) {
+				return true
+			}
+		}
+		return false
+	case Company:
+		return m.MatchString(u.Company)
+	case Country:
+		return m.MatchString(u.Country)
+	case Email:
+		return m.MatchString(u.Email)
+	case Job:
+		return m.MatchString(u.Job)
+	case Name:
+		return m.MatchString(u.Name)
+	case Phone:
+		return m.MatchString(u.Phone)
+	}
+	return false
+}
+
+// Matcher tests a single value of a field, *regexp.Regexp is a Matcher too
+type Matcher interface {
+	MatchString(s string) bool
+}
+
+type containsMatcher string
+
+func (m containsMatcher) MatchString(s string) bool {
+	return strings.Contains(s, string(m))
+}
+
+type prefixMatcher string
+
+func (m prefixMatcher) MatchString(s string) bool {
+	return strings.HasPrefix(s, string(m))
+}
+
+type anyMatcher []Matcher
+
+func (ms anyMatcher) MatchString(s string) bool {
+	for _, m := range ms {
+		if m.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func Contains(substr string) Matcher {
+	return containsMatcher(substr)
+}
+
+func Prefix(prefix string) Matcher {
+	return prefixMatcher(prefix)
+}
+
+// Regexp compiles the expression once, so matching doesn't allocate
+func Regexp(expr string) (Matcher, error) {
+	return regexp.Compile(expr)
+}
+
+// AnyOf accepts a value if one of the matchers does
+func AnyOf(ms ...Matcher) Matcher {
+	return anyMatcher(ms)
+}
+
+type Predicate interface {
+	Match(u *user.User) bool
+}
+
+type fieldPredicate struct {
+	field   Field
+	matcher Matcher
+}
+
+func (p fieldPredicate) Match(u *user.User) bool {
+	return p.field.any(u, p.matcher)
+}
+
+type andPredicate []Predicate
+
+func (ps andPredicate) Match(u *user.User) bool {
+	for _, p := range ps {
+		if !p.Match(u) {
+			return false
+		}
+	}
+	return true
+}
+
+type orPredicate []Predicate
+
+func (ps orPredicate) Match(u *user.User) bool {
+	for _, p := range ps {
+		if p.Match(u) {
+			return true
+		}
+	}
+	return false
+}
+
+type notPredicate struct {
+	p Predicate
+}
+
+func (n notPredicate) Match(u *user.User) bool {
+	return !n.p.Match(u)
+}
+
+// Where matches a user if any value of the field is accepted by the matcher
+func Where(field Field, m Matcher) Predicate {
+	return fieldPredicate{field: field, matcher: m}
+}
+
+func And(ps ...Predicate) Predicate {
+	return andPredicate(ps)
+}
+
+func Or(ps ...Predicate) Predicate {
+	return orPredicate(ps)
+}
+
+func Not(p Predicate) Predicate {
+	return notPredicate{p: p}
+}
+
+// Aggregation sees every scanned user, matched reports whether the query selected it.
+// Fork and Merge let parts of the input be aggregated separately
+type Aggregation interface {
+	Observe(u *user.User, matched bool)
+	// Fork returns an empty aggregation of the same kind
+	Fork() Aggregation
+	// Merge adds the result of a forked aggregation
+	Merge(part Aggregation)
+}
+
+// Count counts the selected users
+type Count struct {
+	N int
+}
+
+func (c *Count) Observe(_ *user.User, matched bool) {
+	if matched {
+		c.N++
+	}
+}
+
+func (c *Count) Fork() Aggregation {
+	return &Count{}
+}
+
+func (c *Count) Merge(part Aggregation) {
+	c.N += part.(*Count).N
+}
+
+// Unique collects distinct values of the field accepted by its matcher
+type Unique struct {
+	field       Field
+	matcher     Matcher
+	onlyMatched bool
+	seen        map[string]struct{}
+}
+
+// NewUnique counts values of every scanned user unless onlyMatched is set, a nil matcher accepts everything
+func NewUnique(field Field, m Matcher, onlyMatched bool) *Unique {
+	if m == nil {
+		m = Prefix("")
+	}
+	return &Unique{
+		field:       field,
+		matcher:     m,
+		onlyMatched: onlyMatched,
+		seen:        make(map[string]struct{}),
+	}
+}
+
+func (a *Unique) Observe(u *user.User, matched bool) {
+	if a.onlyMatched && !matched {
+		return
+	}
+	//values are kept only when new, so that already seen ones don't allocate
+	a.field.any(u, matcherFunc(func(value string) bool {
+		if a.matcher.MatchString(value) {
+			if _, ok := a.seen[value]; !ok {
+				a.seen[value] = struct{}{}
+			}
+		}
+		return false
+	}))
+}
+
+func (a *Unique) Fork() Aggregation {
+	return NewUnique(a.field, a.matcher, a.onlyMatched)
+}
+
+func (a *Unique) Merge(part Aggregation) {
+	for value := range part.(*Unique).seen {
+		a.seen[value] = struct{}{}
+	}
+}
+
+func (a *Unique) Len() int {
+	return len(a.seen)
+}
+
+// Values are sorted
+func (a *Unique) Values() []string {
+	values := make([]string, 0, len(a.seen))
+	for value := range a.seen {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+type matcherFunc func(s string) bool
+
+func (f matcherFunc) MatchString(s string) bool {
+	return f(s)
+}
+
+// Query selects users with Where, all users are selected if it's nil
+type Query struct {
+	Where        Predicate
+	Aggregations []Aggregation
+}
+
+// Run scans one json user per line and calls found for every selected one with its line index.
+// The user is reused for the next line, so found must not keep it
+func Run(r io.Reader, q Query, found func(i int, u *user.User) error) error {
+	_, err := scan(context.Background(), r, 0, q, found)
+	return err
+}
+
+// RunContext is Run stopping with the context error as soon as the context is done
+func RunContext(ctx context.Context, r io.Reader, q Query, found func(i int, u *user.User) error) error {
+	_, err := scan(ctx, r, 0, q, found)
+	return err
+}
+
+// scan numbers lines starting from first and returns how many lines it read
+func scan(ctx context.Context, r io.Reader, first int, q Query, found func(i int, u *user.User) error) (int, error) {
+	scanner := bufio.NewScanner(r)
+	done := ctx.Done()
+	var u user.User
+	i := first
+	for ; scanner.Scan(); i++ {
+		select {
+		case <-done:
+			return i - first, ctx.Err()
+		default:
+		}
+		u = user.User{Browsers: u.Browsers[:0]}
+		if err := easyjson.Unmarshal(scanner.Bytes(), &u); err != nil {
+			return i - first, fmt.Errorf("line %d: %w", i, err)
+		}
+		matched := q.Where == nil || q.Where.Match(&u)
+		for _, a := range q.Aggregations {
+			a.Observe(&u, matched)
+		}
+		if !matched {
+			continue
+		}
+		if err := found(i, &u); err != nil {
+			return i - first, err
+		}
+	}
+	return i - first, scanner.Err()
+}
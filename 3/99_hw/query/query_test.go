@@ -0,0 +1,102 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"hw3/user"
+)
+
+const testUsers = `{"browsers":["Opera/9.80 (Android 2.3.3)","Mozilla/4.0 (compatible; MSIE 8.0)"],"email":"a@mail.ru","name":"Anna","country":"Fiji"}
+{"browsers":["Mozilla/5.0 (Android 4.4)"],"email":"b@mail.ru","name":"Boris","country":"Chad"}
+{"browsers":["Mozilla/4.0 (compatible; MSIE 6.0)"],"email":"c@yandex.ru","name":"Carl","country":"Fiji"}
+{"browsers":[],"email":"d@mail.ru","name":"Dina","country":"Peru"}
+`
+
+func runNames(t *testing.T, q Query) []string {
+	t.Helper()
+	var names []string
+	err := Run(strings.NewReader(testUsers), q, func(i int, u *user.User) error {
+		names = append(names, u.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return names
+}
+
+func TestQueryPredicates(t *testing.T) {
+	mailRu, err := Regexp(`@mail\.ru$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name     string
+		where    Predicate
+		expected []string
+	}{
+		{"all", nil, []string{"Anna", "Boris", "Carl", "Dina"}},
+		{"and", And(Where(Browsers, Contains("Android")), Where(Browsers, Contains("MSIE"))), []string{"Anna"}},
+		{"or", Or(Where(Name, Prefix("B")), Where(Name, Prefix("C"))), []string{"Boris", "Carl"}},
+		{"not", Not(Where(Country, Contains("Fiji"))), []string{"Boris", "Dina"}},
+		{"regexp", And(Where(Email, mailRu), Not(Where(Browsers, Prefix("")))), []string{"Dina"}},
+	}
+	for _, c := range cases {
+		if names := runNames(t, Query{Where: c.where}); !reflect.DeepEqual(names, c.expected) {
+			t.Errorf("%s: got %v, expected %v", c.name, names, c.expected)
+		}
+	}
+}
+
+func TestQueryAggregations(t *testing.T) {
+	count := &Count{}
+	allMSIE := NewUnique(Browsers, Contains("MSIE"), false)
+	countries := NewUnique(Country, nil, true)
+	q := Query{
+		Where:        Where(Browsers, Contains("Android")),
+		Aggregations: []Aggregation{count, allMSIE, countries},
+	}
+	runNames(t, q)
+	if count.N != 2 {
+		t.Errorf("expected 2 selected users, got %d", count.N)
+	}
+	if allMSIE.Len() != 2 {
+		t.Errorf("expected 2 MSIE browsers, got %v", allMSIE.Values())
+	}
+	if values := countries.Values(); !reflect.DeepEqual(values, []string{"Chad", "Fiji"}) {
+		t.Errorf("expected countries of selected users, got %v", values)
+	}
+}
+
+func TestParseField(t *testing.T) {
+	if f, err := ParseField("email"); err != nil || f != Email {
+		t.Errorf("unexpected field %v (%v)", f, err)
+	}
+	if _, err := ParseField("password"); err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+}
+
+func TestRunParallel(t *testing.T) {
+	where := Where(Email, Contains("mail.ru"))
+	expected := runNames(t, Query{Where: where})
+	for workers := 1; workers <= 6; workers++ {
+		var names []string
+		var lines []int
+		count := &Count{}
+		q := Query{Where: where, Aggregations: []Aggregation{count}}
+		err := RunParallel(strings.NewReader(testUsers), int64(len(testUsers)), q, workers, func(i int, u *user.User) error {
+			names = append(names, u.Name)
+			lines = append(lines, i)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%d workers: unexpected error: %v", workers, err)
+		}
+		if !reflect.DeepEqual(names, expected) || !reflect.DeepEqual(lines, []int{0, 1, 3}) || count.N != 3 {
+			t.Errorf("%d workers: got %v at %v counted %d, expected %v", workers, names, lines, count.N, expected)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"hw3/query"
+	"hw3/user"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type SearchOptions struct {
+	// Where selects users, the ones with both Android and MSIE browsers by default
+	Where query.Predicate
+	// Browsers are counted in the footer, Android or MSIE ones by default
+	Browsers query.Matcher
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompress detects gzip and zstd by their magic bytes, any other input is read as is
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return io.NopCloser(br), nil
+}
+
+// Search writes every selected user as soon as it's decoded, the footer is written after the whole input is read.
+// If the context is done the output is cut and the context error is returned
+func Search(ctx context.Context, r io.Reader, out io.Writer, opts SearchOptions) error {
+	input, err := decompress(r)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	q, browsers := searchQuery(opts)
+	if _, err := fmt.Fprintln(out, "found users:"); err != nil {
+		return err
+	}
+	err = query.RunContext(ctx, input, q, func(i int, u *user.User) error {
+		return writeUser(out, i, u)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "\nTotal unique browsers %d\n", browsers.Len())
+	return err
+}
+
+func searchQuery(opts SearchOptions) (query.Query, *query.Unique) {
+	android, msie := query.Contains("Android"), query.Contains("MSIE")
+	where := opts.Where
+	if where == nil {
+		where = query.And(
+			query.Where(query.Browsers, android),
+			query.Where(query.Browsers, msie),
+		)
+	}
+	matcher := opts.Browsers
+	if matcher == nil {
+		matcher = query.AnyOf(android, msie)
+	}
+	browsers := query.NewUnique(query.Browsers, matcher, false)
+	return query.Query{
+		Where:        where,
+		Aggregations: []query.Aggregation{browsers},
+	}, browsers
+}
+
+func writeUser(out io.Writer, i int, u *user.User) error {
+	email := strings.ReplaceAll(u.Email, "@", " [at] ")
+	_, err := fmt.Fprintf(out, "[%d] %s <%s>\n", i, u.Name, email)
+	return err
+}
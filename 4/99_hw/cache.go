@@ -0,0 +1,180 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// размер кеша, если MaxEntries не задан
+const defaultCacheEntries = 1024
+
+// CacheOptions настраивают ResponseCache
+type CacheOptions struct {
+	// сколько живёт ответ, 0 - пока его не вытеснят
+	TTL time.Duration
+	// сколько ответов хранится, при переполнении вытесняется давно не запрошенный
+	MaxEntries int
+}
+
+// CacheStats - счётчики кеша, запрос, дождавшийся такого же запроса в полёте, считается попаданием
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// ResponseCache хранит успешные ответы FindUsers, ошибки не кешируются.
+// Одинаковые запросы, пришедшие одновременно, уходят во внешнюю систему один раз
+type ResponseCache struct {
+	opts CacheOptions
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	inflight map[string]*cacheCall
+	stats    CacheStats
+}
+
+type cacheEntry struct {
+	key     string
+	resp    *SearchResponse
+	expires time.Time
+}
+
+type cacheCall struct {
+	done chan struct{}
+	resp *SearchResponse
+	err  error
+	// canceled - запрос прервала отмена контекста первого вызывающего, а не внешняя система
+	canceled bool
+}
+
+func NewResponseCache(opts CacheOptions) *ResponseCache {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultCacheEntries
+	}
+	return &ResponseCache{
+		opts:     opts,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[string]*cacheCall),
+	}
+}
+
+// Stats возвращает счётчики попаданий и промахов
+func (c *ResponseCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Len возвращает количество хранящихся ответов, включая устаревшие
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Invalidate убирает ответ по ключу, запрос в полёте после этого не попадёт в кеш
+func (c *ResponseCache) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	delete(c.inflight, key)
+}
+
+// Purge убирает все ответы
+func (c *ResponseCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.inflight = make(map[string]*cacheCall)
+}
+
+// get возвращает копию ответа из кеша или от fetch. Ожидающие одного запроса получают результат первого,
+// а если первый отменил свой контекст - повторяют запрос сами. Ожидание прерывает только свой контекст
+func (c *ResponseCache) get(ctx context.Context, key string, fetch func(ctx context.Context) (*SearchResponse, error)) (*SearchResponse, error) {
+	for {
+		c.mu.Lock()
+		if elem, ok := c.entries[key]; ok {
+			entry := elem.Value.(*cacheEntry)
+			if entry.expires.IsZero() || time.Now().Before(entry.expires) {
+				c.lru.MoveToFront(elem)
+				c.stats.Hits++
+				c.mu.Unlock()
+				return copyResponse(entry.resp), nil
+			}
+			c.remove(elem)
+		}
+		call, ok := c.inflight[key]
+		if !ok {
+			break
+		}
+		c.stats.Hits++
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if call.canceled {
+			continue
+		}
+		if call.err != nil {
+			return nil, call.err
+		}
+		return copyResponse(call.resp), nil
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	call.resp, call.err = fetch(ctx)
+	call.canceled = call.err != nil && ctx.Err() != nil
+
+	// запрос убирается из полёта до того, как о нём узнают ожидающие, чтобы повтор не застал его снова
+	c.mu.Lock()
+	if c.inflight[key] == call {
+		delete(c.inflight, key)
+		if call.err == nil {
+			c.add(key, call.resp)
+		}
+	}
+	c.mu.Unlock()
+	close(call.done)
+	if call.err != nil {
+		return nil, call.err
+	}
+	return copyResponse(call.resp), nil
+}
+
+// add вызывается под mu
+func (c *ResponseCache) add(key string, resp *SearchResponse) {
+	entry := &cacheEntry{key: key, resp: resp}
+	if c.opts.TTL > 0 {
+		entry.expires = time.Now().Add(c.opts.TTL)
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.opts.MaxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove вызывается под mu
+func (c *ResponseCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// copyResponse не даёт вызывающему испортить закешированный ответ
+func copyResponse(resp *SearchResponse) *SearchResponse {
+	result := *resp
+	result.Users = make([]User, len(resp.Users))
+	copy(result.Users, resp.Users)
+	return &result
+}
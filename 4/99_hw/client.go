@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
@@ -17,6 +19,11 @@ var (
 	client  = &http.Client{Timeout: time.Second}
 )
 
+const (
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	defaultRetryMaxDelay  = 2 * time.Second
+)
+
 type User struct {
 	Id     int
 	Name   string
@@ -55,21 +62,90 @@ type SearchClient struct {
 	AccessToken string
 	// урл внешней системы, куда идти
 	URL string
+	// клиент, через который идут запросы, если не задан - используется общий с таймаутом в секунду
+	Client *http.Client
+	// повторы запросов при таймаутах и 5xx, по умолчанию запрос не повторяется
+	Retry RetryPolicy
+	// кеш ответов, может быть общим для нескольких клиентов, по умолчанию не используется
+	Cache *ResponseCache
+}
+
+// RetryPolicy описывает повторы с экспоненциальной задержкой и случайным разбросом
+type RetryPolicy struct {
+	// сколько раз повторить запрос после первой попытки
+	MaxRetries int
+	// задержка перед первым повтором, дальше она удваивается
+	BaseDelay time.Duration
+	// максимальная задержка между попытками
+	MaxDelay time.Duration
+}
+
+// delay возвращает задержку перед повтором номер attempt (с нуля) - случайное значение от половины до полной задержки
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	base, maxDelay := p.BaseDelay, p.MaxDelay
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	d := base
+	for i := 0; i < attempt && d < maxDelay; i++ {
+		d *= 2
+	}
+	if d > maxDelay {
+		d = maxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
 }
 
 // FindUsers отправляет запрос во внешнюю систему, которая непосредственно ищет пользоваталей
 func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
+	return srv.FindUsersContext(context.Background(), req)
+}
+
+// FindUsersContext - то же, что FindUsers, но запрос и паузы между повторами прерываются отменой контекста
+func (srv *SearchClient) FindUsersContext(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	req, searcherParams, err := normalize(req)
+	if err != nil {
+		return nil, err
+	}
+	if srv.Cache != nil {
+		return srv.Cache.get(ctx, srv.cacheKey(searcherParams), func(ctx context.Context) (*SearchResponse, error) {
+			return srv.search(ctx, req, searcherParams)
+		})
+	}
+	return srv.search(ctx, req, searcherParams)
+}
+
+// InvalidateCache убирает из кеша ответ на запрос, если кеш задан
+func (srv *SearchClient) InvalidateCache(req SearchRequest) {
+	if srv.Cache == nil {
+		return
+	}
+	if _, searcherParams, err := normalize(req); err == nil {
+		srv.Cache.Invalidate(srv.cacheKey(searcherParams))
+	}
+}
+
+// cacheKey различает ответы разных внешних систем и токенов
+func (srv *SearchClient) cacheKey(params url.Values) string {
+	return srv.URL + "\x00" + srv.AccessToken + "\x00" + params.Encode()
+}
+
+// normalize проверяет запрос и приводит его к тому виду, в котором он уходит во внешнюю систему
+func normalize(req SearchRequest) (SearchRequest, url.Values, error) {
 
 	searcherParams := url.Values{}
 
 	if req.Limit < 0 {
-		return nil, fmt.Errorf("limit must be > 0")
+		return req, nil, fmt.Errorf("limit must be > 0")
 	}
 	if req.Limit > 25 {
 		req.Limit = 25
 	}
 	if req.Offset < 0 {
-		return nil, fmt.Errorf("offset must be > 0")
+		return req, nil, fmt.Errorf("offset must be > 0")
 	}
 
 	//нужно для получения следующей записи, на основе которой мы скажем - можно показать переключатель следующей страницы или нет
@@ -81,32 +157,29 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 	searcherParams.Add("order_field", req.OrderField)
 	searcherParams.Add("order_by", strconv.Itoa(req.OrderBy))
 
-	searcherReq, err := http.NewRequest("GET", srv.URL+"?"+searcherParams.Encode(), nil)
-	searcherReq.Header.Add("AccessToken", srv.AccessToken)
+	return req, searcherParams, nil
+}
 
-	resp, err := client.Do(searcherReq)
+// search отправляет нормализованный запрос и разбирает ответ
+func (srv *SearchClient) search(ctx context.Context, req SearchRequest, searcherParams url.Values) (*SearchResponse, error) {
+	status, body, err := srv.doWithRetries(ctx, searcherParams)
 	if err != nil {
-		if err, ok := err.(net.Error); ok && err.Timeout() {
-			return nil, fmt.Errorf("timeout for %s", searcherParams.Encode())
-		}
-		return nil, fmt.Errorf("unknown error %s", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
 
-	switch resp.StatusCode {
+	switch status {
 	case http.StatusUnauthorized:
-		return nil, fmt.Errorf("Bad AccessToken")
+		return nil, ErrUnauthorized
 	case http.StatusInternalServerError:
-		return nil, fmt.Errorf("SearchServer fatal error")
+		return nil, ErrServerFatal
 	case http.StatusBadRequest:
 		errResp := SearchErrorResponse{}
 		err = json.Unmarshal(body, &errResp)
 		if err != nil {
-			return nil, fmt.Errorf("cant unpack error json: %s", err)
+			return nil, newDecodeError("error", body, err)
 		}
 		if errResp.Error == "ErrorBadOrderField" {
-			return nil, fmt.Errorf("OrderFeld %s invalid", req.OrderField)
+			return nil, &BadOrderFieldError{Field: req.OrderField}
 		}
 		return nil, fmt.Errorf("unknown bad request error: %s", errResp.Error)
 	}
@@ -114,7 +187,7 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 	data := []User{}
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		return nil, fmt.Errorf("cant unpack result json: %s", err)
+		return nil, newDecodeError("result", body, err)
 	}
 
 	result := SearchResponse{}
@@ -127,3 +200,56 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 
 	return &result, err
 }
+
+// doWithRetries повторяет запрос при таймаутах и 5xx, ответы 4xx никогда не повторяются
+func (srv *SearchClient) doWithRetries(ctx context.Context, params url.Values) (int, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		status, body, err := srv.do(ctx, params)
+		if ctx.Err() != nil {
+			return 0, nil, fmt.Errorf("request canceled for %s: %w", params.Encode(), ctx.Err())
+		}
+		timeout := isTimeout(err)
+		if attempt < srv.Retry.MaxRetries && (timeout || err == nil && status >= http.StatusInternalServerError) {
+			timer := time.NewTimer(srv.Retry.delay(attempt))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return 0, nil, fmt.Errorf("request canceled for %s: %w", params.Encode(), ctx.Err())
+			case <-timer.C:
+			}
+			continue
+		}
+		if timeout {
+			return 0, nil, &TimeoutError{Params: params.Encode(), Err: err}
+		}
+		if err != nil {
+			return 0, nil, fmt.Errorf("unknown error %s", err)
+		}
+		return status, body, nil
+	}
+}
+
+func (srv *SearchClient) do(ctx context.Context, params url.Values) (int, []byte, error) {
+	searcherReq, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"?"+params.Encode(), nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	searcherReq.Header.Add("AccessToken", srv.AccessToken)
+
+	httpClient := srv.Client
+	if httpClient == nil {
+		httpClient = client
+	}
+	resp, err := httpClient.Do(searcherReq)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, body, err
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -1,58 +1,22 @@
 package main
 
 import (
-	"cmp"
-	"encoding/json"
-	"encoding/xml"
+	"context"
 	"errors"
-	"fmt"
+	"hw4/searchserver"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"slices"
-	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 const datasetPath = "dataset.xml"
 
-type Root struct {
-	XMLName xml.Name `xml:"root"`
-	Rows    []Row    `xml:"row"`
-}
-
-type Row struct {
-	Id             int    `xml:"id"`
-	Guid           string `xml:"guid"`
-	IsActive       bool   `xml:"isActive"`
-	Balance        string `xml:"balance"`
-	PictureUrl     string `xml:"picture"`
-	Age            int    `xml:"age"`
-	EyeColor       string `xml:"eyeColor"`
-	FirstName      string `xml:"first_name"`
-	LastName       string `xml:"last_name"`
-	Gender         string `xml:"gender"`
-	Company        string `xml:"company"`
-	Email          string `xml:"email"`
-	Phone          string `xml:"phone"`
-	Address        string `xml:"address"`
-	About          string `xml:"about"`
-	Registered     string `xml:"registered"`
-	FavouriteFruit string `xml:"favourite_fruit"`
-}
-
-func (r Row) ToUser() User {
-	return User{
-		Id:     r.Id,
-		Name:   r.FirstName + " " + r.LastName,
-		Age:    r.Age,
-		About:  r.About,
-		Gender: r.Gender,
-	}
-}
-
 func SearchServerBadResultJson(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write([]byte(`[{"Id":15,"Name":"Allison Valdez","Age":21,"About":"Labore excepteur voluptate velit occaecat est nisi minim. Laborum ea et irure nostrud enim sit incididunt reprehenderit id est nostrud eu. Ullamco sint nisi voluptate cillum nostrud aliquip et minim. Enim duis esse do aute qui officia ipsum ut occaecat deserunt`))
 }
@@ -70,196 +34,17 @@ func SearchServerNonStopRedirection(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, r.URL.String(), http.StatusTemporaryRedirect)
 }
 
-func SearchServer(w http.ResponseWriter, r *http.Request) {
-	accessToken := r.Header.Get("AccessToken")
-	if accessToken == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
-	params, err := receiveSearchRequest(r)
-	if err != nil {
-		response := SearchErrorResponse{err.Error()}
-		marshalledResponse, err := json.Marshal(response)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusBadRequest)
-		_, _ = w.Write(marshalledResponse)
-		return
-	}
-
-	file, err := os.ReadFile(datasetPath)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	var dataset Root
-	err = xml.Unmarshal(file, &dataset)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	users := func(rows []Row) []User {
-		res := make([]User, len(rows))
-		for i := range rows {
-			res[i] = rows[i].ToUser()
-		}
-		return res
-	}(dataset.Rows)
-
-	results, err := searchServer(
-		users,
-		params.Query,
-		params.OrderField,
-		params.OrderBy,
-		params.Limit,
-		params.Offset,
-	)
-	if err != nil {
-		response := SearchErrorResponse{err.Error()}
-		marshalledResponse, err := json.Marshal(response)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusBadRequest)
-		_, _ = w.Write(marshalledResponse)
-		return
-	}
-
-	marshalledResults, err := json.Marshal(results)
+// testServer is loaded once, the dataset file doesn't change during the tests
+var testServer = func() *searchserver.Server {
+	srv, err := searchserver.New(searchserver.Config{DatasetPath: datasetPath})
 	if err != nil {
-		panic(fmt.Errorf("cannot pack results into json: %w", err))
-	}
-
-	_, _ = w.Write(marshalledResults)
-}
-
-func receiveSearchRequest(r *http.Request) (SearchRequest, error) {
-	errs := make([]error, 0, 3)
-
-	query := r.FormValue("query")
-	orderField := r.FormValue("order_field")
-	orderBy, err := strconv.Atoi(r.FormValue("order_by"))
-	if err != nil {
-		errs = append(errs, fmt.Errorf("could not parse order_by: %w", err))
-	}
-	limit, err := strconv.Atoi(r.FormValue("limit"))
-	if err != nil {
-		// cannot parse to int
-		errs = append(errs, fmt.Errorf("could not parse limit: %w", err))
-	}
-	offset, err := strconv.Atoi(r.FormValue("offset"))
-	if err != nil {
-		// cannot parse to int
-		errs = append(errs, fmt.Errorf("could not parse offset: %w", err))
-	}
-
-	var resErr error = nil
-	if len(errs) != 0 {
-		errsStr := ""
-		for _, err = range errs {
-			errsStr += err.Error() + ";"
-		}
-		resErr = errors.New(errsStr)
-	}
-
-	return SearchRequest{
-		Limit:      limit,
-		Offset:     offset,
-		Query:      query,
-		OrderField: orderField,
-		OrderBy:    orderBy,
-	}, resErr
-}
-
-// searchServer creates its own slice of users
-// so, it's ok to use results of function without worrying it'll change
-// incoming data
-func searchServer(users []User, query string, orderField string, orderBy int, limit int, offset int) ([]User, error) {
-	result := filter(users, containsQueryInNameOrAbout(query))
-
-	cmpFunc, err := cmpUser(orderField, orderBy)
-	if err != nil {
-		return nil, err
-	}
-	slices.SortFunc(result, cmpFunc)
-
-	return withOffsetAndLimit(result, limit, offset)
-}
-
-// filter creates a new slice
-func filter[T any](elems []T, predicate func(T) bool) []T {
-	res := make([]T, 0, len(elems))
-	for _, el := range elems {
-		if predicate(el) {
-			res = append(res, el)
-		}
-	}
-	return res
-}
-
-// containsQueryInNameOrAbout creates a predicate
-// for checking if user contains query in Name or About field
-func containsQueryInNameOrAbout(query string) func(u User) bool {
-	return func(u User) bool {
-		return strings.Contains(u.Name, query) || strings.Contains(u.About, query)
-	}
-}
-
-// cmpUser creates a function for sorting slice of users
-// if orderField, orderBy are incorrect returns error
-func cmpUser(orderField string, orderBy int) (func(a, b User) int, error) {
-	var cmpFunc func(a, b User) int
-	switch orderField {
-	case "Id":
-		cmpFunc = func(a, b User) int {
-			return cmp.Compare(a.Id, b.Id)
-		}
-	case "", "Name":
-		cmpFunc = func(a, b User) int {
-			return cmp.Compare(a.Name, b.Name)
-		}
-	case "Age":
-		cmpFunc = func(a, b User) int {
-			return cmp.Compare(a.Age, b.Age)
-		}
-	default:
-		return nil, errors.New("ErrorBadOrderField")
+		panic(err)
 	}
+	return srv
+}()
 
-	switch orderBy {
-	case OrderByAsc, OrderByAsIs, OrderByDesc:
-	default:
-		return nil, errors.New("bad orderBy value, must be -1, 0 or 1")
-	}
-
-	return func(a, b User) int {
-		//-orderBy because orderByAsc = -1 and sortFunc sorts by asc by default
-		//so -orderBy = 1, and it keeps ascending order
-		return -orderBy * cmpFunc(a, b)
-	}, nil
-}
-
-func withOffsetAndLimit[T any](elems []T, limit, offset int) ([]T, error) {
-	if offset < 0 {
-		return nil, errors.New("offset must be >= 0")
-	}
-	if offset > len(elems) {
-		return nil, errors.New("offset must be <= len(elems)")
-	}
-	if limit < 0 {
-		return nil, errors.New("limit must be >= 0")
-	}
-	if limit+offset <= len(elems) {
-		return elems[offset : offset+limit], nil
-	} else {
-		return elems[offset:], nil
-	}
+func SearchServer(w http.ResponseWriter, r *http.Request) {
+	testServer.ServeHTTP(w, r)
 }
 
 func TestSearchServer(t *testing.T) {
@@ -445,3 +230,475 @@ func TestSearchServer(t *testing.T) {
 	}
 
 }
+
+// countingServer serves the handler and counts the requests it gets
+func countingServer(handler http.HandlerFunc) (*httptest.Server, *int32) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		handler(w, r)
+	}))
+	return ts, &calls
+}
+
+// failingFirst fails the first n requests with the failing handler, the rest go to SearchServer
+func failingFirst(n int32, failing http.HandlerFunc) http.HandlerFunc {
+	var calls int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= n {
+			failing(w, r)
+			return
+		}
+		SearchServer(w, r)
+	}
+}
+
+func TestFindUsersRetries(t *testing.T) {
+	retry := RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}
+	unavailable := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	badRequest := SearchRequest{Limit: 1, OrderField: "wtf"}
+
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		accessToken string
+		request     SearchRequest
+		expectCalls int32
+		expectError bool
+	}{
+		{"internal error recovers", failingFirst(2, SearchServerInternalError), "kek", SearchRequest{Limit: 1}, 3, false},
+		{"unavailable recovers", failingFirst(1, unavailable), "kek", SearchRequest{Limit: 1}, 2, false},
+		{"timeout recovers", failingFirst(1, slow), "kek", SearchRequest{Limit: 1}, 2, false},
+		{"internal error gives up", SearchServerInternalError, "kek", SearchRequest{Limit: 1}, 3, true},
+		{"timeout gives up", slow, "kek", SearchRequest{Limit: 1}, 3, true},
+		{"no retry on bad request", SearchServer, "kek", badRequest, 1, true},
+		{"no retry on unauthorized", SearchServer, "", SearchRequest{Limit: 1}, 1, true},
+	}
+
+	for _, tt := range tests {
+		ts, calls := countingServer(tt.handler)
+		client := SearchClient{
+			AccessToken: tt.accessToken,
+			URL:         ts.URL,
+			Client:      &http.Client{Timeout: 50 * time.Millisecond},
+			Retry:       retry,
+		}
+
+		resp, err := client.FindUsersContext(context.Background(), tt.request)
+		ts.Close()
+
+		if tt.expectError && err == nil {
+			t.Errorf("[%s] expected error, got nil", tt.name)
+		}
+		if !tt.expectError && (err != nil || len(resp.Users) != 1) {
+			t.Errorf("[%s] expected one user, got %v, %v", tt.name, resp, err)
+		}
+		if got := atomic.LoadInt32(calls); got != tt.expectCalls {
+			t.Errorf("[%s] expected %d calls, got %d", tt.name, tt.expectCalls, got)
+		}
+	}
+}
+
+func TestFindUsersContextCanceled(t *testing.T) {
+	ts, calls := countingServer(SearchServerInternalError)
+	defer ts.Close()
+
+	client := SearchClient{
+		AccessToken: "kek",
+		URL:         ts.URL,
+		Retry:       RetryPolicy{MaxRetries: 10, BaseDelay: time.Hour, MaxDelay: time.Hour},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.FindUsersContext(ctx, SearchRequest{Limit: 1})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("expected a single call before the backoff, got %d", got)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	expected := []time.Duration{10, 20, 40, 50, 50}
+	for attempt, full := range expected {
+		full *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			if d := p.delay(attempt); d < full/2 || d > full {
+				t.Errorf("attempt %d: delay %v is out of [%v, %v]", attempt, d, full/2, full)
+			}
+		}
+	}
+}
+
+func TestFindUsersTypedErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	tsBadResultJson := httptest.NewServer(http.HandlerFunc(SearchServerBadResultJson))
+	defer tsBadResultJson.Close()
+	tsBadErrorJson := httptest.NewServer(http.HandlerFunc(SearchServerBadErrorJson))
+	defer tsBadErrorJson.Close()
+	tsInternalError := httptest.NewServer(http.HandlerFunc(SearchServerInternalError))
+	defer tsInternalError.Close()
+	tsTimeout := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer tsTimeout.Close()
+
+	tests := []struct {
+		name        string
+		server      *httptest.Server
+		accessToken string
+		request     SearchRequest
+		message     string
+		check       func(err error) bool
+	}{
+		{
+			name:    "unauthorized",
+			server:  ts,
+			message: "Bad AccessToken",
+			check:   func(err error) bool { return errors.Is(err, ErrUnauthorized) },
+		},
+		{
+			name:        "server fatal",
+			server:      tsInternalError,
+			accessToken: "kek",
+			message:     "SearchServer fatal error",
+			check:       func(err error) bool { return errors.Is(err, ErrServerFatal) },
+		},
+		{
+			name:        "bad order field",
+			server:      ts,
+			accessToken: "kek",
+			request:     SearchRequest{OrderField: "wtf"},
+			message:     "OrderFeld wtf invalid",
+			check: func(err error) bool {
+				var orderErr *BadOrderFieldError
+				return errors.As(err, &orderErr) && orderErr.Field == "wtf"
+			},
+		},
+		{
+			name:        "timeout",
+			server:      tsTimeout,
+			accessToken: "kek",
+			message:     "timeout for limit=1&offset=0&order_by=0&order_field=&query=",
+			check: func(err error) bool {
+				var timeoutErr *TimeoutError
+				var netErr net.Error
+				return errors.As(err, &timeoutErr) && errors.As(err, &netErr) && netErr == net.Error(timeoutErr) && netErr.Timeout()
+			},
+		},
+		{
+			name:        "bad result json",
+			server:      tsBadResultJson,
+			accessToken: "kek",
+			message:     "cant unpack result json: unexpected end of JSON input",
+			check: func(err error) bool {
+				var decodeErr *DecodeError
+				return errors.As(err, &decodeErr) && decodeErr.Kind == "result" &&
+					len(decodeErr.Body) == decodeSnippetLen && strings.HasPrefix(decodeErr.Body, `[{"Id":15,`)
+			},
+		},
+		{
+			name:        "bad error json",
+			server:      tsBadErrorJson,
+			accessToken: "kek",
+			message:     "cant unpack error json: unexpected end of JSON input",
+			check: func(err error) bool {
+				var decodeErr *DecodeError
+				return errors.As(err, &decodeErr) && decodeErr.Kind == "error" && decodeErr.Body == `{"Error": "ErrorBadOrderField"`
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		client := SearchClient{
+			AccessToken: tt.accessToken,
+			URL:         tt.server.URL,
+			Client:      &http.Client{Timeout: 50 * time.Millisecond},
+		}
+
+		_, err := client.FindUsers(tt.request)
+
+		if err == nil {
+			t.Errorf("[%s] expected error, got nil", tt.name)
+			continue
+		}
+		if err.Error() != tt.message {
+			t.Errorf("[%s] expected message %q, got %q", tt.name, tt.message, err.Error())
+		}
+		if !tt.check(err) {
+			t.Errorf("[%s] unexpected error type %T: %v", tt.name, err, err)
+		}
+	}
+}
+
+func collectUsers(cursor *UserCursor) ([]User, error) {
+	defer cursor.Close()
+	users := []User{}
+	for cursor.Next() {
+		users = append(users, cursor.User())
+	}
+	return users, cursor.Err()
+}
+
+func datasetUsers(t *testing.T, query string, orderField string, orderBy int) []User {
+	found, err := testServer.Search(searchserver.Request{
+		Query:      query,
+		OrderField: orderField,
+		OrderBy:    orderBy,
+		Limit:      math.MaxInt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := make([]User, len(found))
+	for i, u := range found {
+		users[i] = User(u)
+	}
+	return users
+}
+
+func TestAllUsers(t *testing.T) {
+	ts, calls := countingServer(SearchServer)
+	defer ts.Close()
+	client := &SearchClient{AccessToken: "kek", URL: ts.URL}
+	all := datasetUsers(t, "", "Age", OrderByDesc)
+
+	tests := []struct {
+		name        string
+		request     SearchRequest
+		options     CursorOptions
+		expected    []User
+		expectCalls int32
+	}{
+		{"default page size", SearchRequest{OrderField: "Age", OrderBy: OrderByDesc}, CursorOptions{}, all, 2},
+		{"small pages", SearchRequest{Limit: 10, OrderField: "Age", OrderBy: OrderByDesc}, CursorOptions{}, all, 4},
+		{"prefetch", SearchRequest{Limit: 10, OrderField: "Age", OrderBy: OrderByDesc}, CursorOptions{Prefetch: true}, all, 4},
+		{"offset", SearchRequest{Limit: 10, Offset: 30, OrderField: "Age", OrderBy: OrderByDesc}, CursorOptions{}, all[30:], 1},
+		{"max", SearchRequest{Limit: 10, OrderField: "Age", OrderBy: OrderByDesc}, CursorOptions{Max: 12}, all[:12], 2},
+		{"max with prefetch", SearchRequest{Limit: 10, OrderField: "Age", OrderBy: OrderByDesc}, CursorOptions{Max: 20, Prefetch: true}, all[:20], 2},
+		{"query", SearchRequest{Limit: 2, Query: "Boyd"}, CursorOptions{}, datasetUsers(t, "Boyd", "", OrderByAsIs), 1},
+	}
+
+	for _, tt := range tests {
+		atomic.StoreInt32(calls, 0)
+
+		users, err := collectUsers(client.AllUsers(context.Background(), tt.request, tt.options))
+
+		if err != nil {
+			t.Errorf("[%s] unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(users, tt.expected) {
+			t.Errorf("[%s] expected %d users, got %d:\n%v", tt.name, len(tt.expected), len(users), users)
+		}
+		if got := atomic.LoadInt32(calls); got != tt.expectCalls {
+			t.Errorf("[%s] expected %d calls, got %d", tt.name, tt.expectCalls, got)
+		}
+	}
+}
+
+func TestAllUsersError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	tsInternalError := httptest.NewServer(http.HandlerFunc(SearchServerInternalError))
+	defer tsInternalError.Close()
+
+	client := &SearchClient{AccessToken: "", URL: ts.URL}
+	users, err := collectUsers(client.AllUsers(context.Background(), SearchRequest{}, CursorOptions{Prefetch: true}))
+	if !errors.Is(err, ErrUnauthorized) || len(users) != 0 {
+		t.Errorf("expected ErrUnauthorized and no users, got %v, %v", users, err)
+	}
+
+	client = &SearchClient{AccessToken: "kek", URL: tsInternalError.URL}
+	cursor := client.AllUsers(context.Background(), SearchRequest{}, CursorOptions{})
+	if cursor.Next() || cursor.Next() {
+		t.Errorf("expected no users")
+	}
+	if !errors.Is(cursor.Err(), ErrServerFatal) {
+		t.Errorf("expected ErrServerFatal, got %v", cursor.Err())
+	}
+	cursor.Close()
+}
+
+func TestResponseCache(t *testing.T) {
+	ts, calls := countingServer(SearchServer)
+	defer ts.Close()
+	cache := NewResponseCache(CacheOptions{MaxEntries: 2})
+	client := &SearchClient{AccessToken: "kek", URL: ts.URL, Cache: cache}
+	otherToken := &SearchClient{AccessToken: "lol", URL: ts.URL, Cache: cache}
+	first, second := SearchRequest{Limit: 1}, SearchRequest{Limit: 2}
+
+	steps := []struct {
+		name        string
+		client      *SearchClient
+		request     SearchRequest
+		expectCalls int32
+	}{
+		{"first miss", client, first, 1},
+		{"first hit", client, first, 1},
+		{"limit is normalized", client, SearchRequest{Limit: 100}, 2},
+		{"same after normalization", client, SearchRequest{Limit: 25}, 2},
+		{"other token evicts first", otherToken, first, 3},
+		{"first evicted", client, first, 4},
+		{"other token hit", otherToken, first, 4},
+		{"limit 25 evicted", client, SearchRequest{Limit: 25}, 5},
+		{"second miss", client, second, 6},
+		{"second hit", client, second, 6},
+	}
+	for _, step := range steps {
+		expectUsers := step.request.Limit
+		if expectUsers > 25 {
+			expectUsers = 25
+		}
+		resp, err := step.client.FindUsers(step.request)
+		if err != nil || len(resp.Users) != expectUsers {
+			t.Errorf("[%s] unexpected result %v, %v", step.name, resp, err)
+		}
+		if got := atomic.LoadInt32(calls); got != step.expectCalls {
+			t.Errorf("[%s] expected %d calls, got %d", step.name, step.expectCalls, got)
+		}
+	}
+	if stats := cache.Stats(); stats != (CacheStats{Hits: 4, Misses: 6}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if cache.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", cache.Len())
+	}
+
+	resp, _ := client.FindUsers(second)
+	resp.Users[0].Name = "changed"
+	if resp, _ := client.FindUsers(second); resp.Users[0].Name == "changed" {
+		t.Error("the cached response is changed by the caller")
+	}
+
+	client.InvalidateCache(second)
+	if _, err := client.FindUsers(second); err != nil || atomic.LoadInt32(calls) != 7 {
+		t.Errorf("expected a call after invalidation, got %d calls, %v", atomic.LoadInt32(calls), err)
+	}
+	cache.Purge()
+	if cache.Len() != 0 {
+		t.Errorf("expected no entries after purge, got %d", cache.Len())
+	}
+}
+
+func TestResponseCacheTTL(t *testing.T) {
+	ts, calls := countingServer(SearchServer)
+	defer ts.Close()
+	client := &SearchClient{AccessToken: "kek", URL: ts.URL, Cache: NewResponseCache(CacheOptions{TTL: 50 * time.Millisecond})}
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.FindUsers(SearchRequest{Limit: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := client.FindUsers(SearchRequest{Limit: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("expected 2 calls, got %d", got)
+	}
+}
+
+func TestResponseCacheErrors(t *testing.T) {
+	ts, calls := countingServer(SearchServerInternalError)
+	defer ts.Close()
+	client := &SearchClient{AccessToken: "kek", URL: ts.URL, Cache: NewResponseCache(CacheOptions{})}
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.FindUsers(SearchRequest{Limit: 1}); !errors.Is(err, ErrServerFatal) {
+			t.Errorf("expected ErrServerFatal, got %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("errors must not be cached, got %d calls", got)
+	}
+}
+
+func TestResponseCacheSingleFlight(t *testing.T) {
+	release := make(chan struct{})
+	ts, calls := countingServer(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		SearchServer(w, r)
+	})
+	defer ts.Close()
+	cache := NewResponseCache(CacheOptions{})
+	client := &SearchClient{AccessToken: "kek", URL: ts.URL, Cache: cache}
+
+	const callers = 10
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			_, err := client.FindUsers(SearchRequest{Limit: 5})
+			errs <- err
+		}()
+	}
+	for cache.Stats().Hits+cache.Stats().Misses < callers {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for i := 0; i < callers; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("expected a single call, got %d", got)
+	}
+	if stats := cache.Stats(); stats != (CacheStats{Hits: callers - 1, Misses: 1}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestResponseCacheLeaderCanceled(t *testing.T) {
+	cache := NewResponseCache(CacheOptions{})
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := cache.get(leaderCtx, "key", func(ctx context.Context) (*SearchResponse, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		leaderErr <- err
+	}()
+	<-started
+
+	var fetches int32
+	type result struct {
+		resp *SearchResponse
+		err  error
+	}
+	waiter := make(chan result, 1)
+	go func() {
+		resp, err := cache.get(context.Background(), "key", func(ctx context.Context) (*SearchResponse, error) {
+			atomic.AddInt32(&fetches, 1)
+			return &SearchResponse{Users: []User{{Id: 1}}}, nil
+		})
+		waiter <- result{resp, err}
+	}()
+	for cache.Stats().Hits == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader: expected context.Canceled, got %v", err)
+	}
+	// ожидающий со своим живым контекстом повторяет запрос, а не получает отмену первого
+	got := <-waiter
+	if got.err != nil || len(got.resp.Users) != 1 || atomic.LoadInt32(&fetches) != 1 {
+		t.Errorf("waiter: got %+v, %v after %d fetches", got.resp, got.err, atomic.LoadInt32(&fetches))
+	}
+}
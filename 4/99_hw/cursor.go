@@ -0,0 +1,123 @@
+package main
+
+import "context"
+
+// максимальный размер страницы, больше FindUsers не вернёт
+const maxPageSize = 25
+
+// CursorOptions настраивают обход страниц
+type CursorOptions struct {
+	// сколько пользователей вернуть всего, 0 - без ограничения
+	Max int
+	// загружать следующую страницу в фоне, пока читается текущая
+	Prefetch bool
+}
+
+// UserCursor по очереди отдаёт пользователей со всех страниц результата, запрашивая их через FindUsersContext.
+// Все страницы запрашиваются с одинаковыми Query, OrderField и OrderBy, меняется только Offset
+type UserCursor struct {
+	srv    *SearchClient
+	ctx    context.Context
+	cancel context.CancelFunc
+	req    SearchRequest
+	opts   CursorOptions
+
+	users []User
+	user  User
+	seen  int
+	done  bool
+	err   error
+	// результат фоновой загрузки следующей страницы, nil если загрузки нет
+	next chan page
+}
+
+type page struct {
+	resp *SearchResponse
+	err  error
+}
+
+// AllUsers начинает обход с req.Offset страницами по req.Limit пользователей (по 25, если Limit не задан).
+// Курсор надо закрыть через Close, чтобы остановить фоновую загрузку
+func (srv *SearchClient) AllUsers(ctx context.Context, req SearchRequest, opts CursorOptions) *UserCursor {
+	if req.Limit <= 0 || req.Limit > maxPageSize {
+		req.Limit = maxPageSize
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &UserCursor{srv: srv, ctx: ctx, cancel: cancel, req: req, opts: opts}
+}
+
+// Next переходит к следующему пользователю, false - пользователи кончились или случилась ошибка, см. Err
+func (c *UserCursor) Next() bool {
+	if c.opts.Max > 0 && c.seen >= c.opts.Max {
+		return false
+	}
+	for len(c.users) == 0 {
+		if c.done || c.err != nil {
+			return false
+		}
+		c.fetch()
+	}
+	c.user, c.users = c.users[0], c.users[1:]
+	c.seen++
+	return true
+}
+
+// User возвращает текущего пользователя
+func (c *UserCursor) User() User {
+	return c.user
+}
+
+// Err возвращает ошибку, на которой остановился обход
+func (c *UserCursor) Err() error {
+	return c.err
+}
+
+// Close прерывает фоновую загрузку, курсор после этого не используется
+func (c *UserCursor) Close() {
+	c.cancel()
+}
+
+func (c *UserCursor) fetch() {
+	var p page
+	if c.next != nil {
+		p = <-c.next
+		c.next = nil
+	} else {
+		p = c.load(c.pageRequest())
+	}
+	if p.err != nil {
+		c.err = p.err
+		return
+	}
+
+	c.users = p.resp.Users
+	c.req.Offset += len(c.users)
+	if !p.resp.NextPage || len(c.users) == 0 || c.opts.Max > 0 && c.seen+len(c.users) >= c.opts.Max {
+		c.done = true
+		return
+	}
+	if c.opts.Prefetch {
+		next, req := make(chan page, 1), c.pageRequest()
+		go func() {
+			next <- c.load(req)
+		}()
+		c.next = next
+	}
+}
+
+// pageRequest не запрашивает больше пользователей, чем осталось до Max
+func (c *UserCursor) pageRequest() SearchRequest {
+	req := c.req
+	if c.opts.Max > 0 {
+		// пользователи текущей страницы ещё не прочитаны, но уже получены
+		if left := c.opts.Max - c.seen - len(c.users); left < req.Limit {
+			req.Limit = left
+		}
+	}
+	return req
+}
+
+func (c *UserCursor) load(req SearchRequest) page {
+	resp, err := c.srv.FindUsersContext(c.ctx, req)
+	return page{resp: resp, err: err}
+}
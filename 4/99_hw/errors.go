@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+var (
+	// ErrUnauthorized - внешняя система не приняла AccessToken
+	ErrUnauthorized = errors.New("Bad AccessToken")
+	// ErrServerFatal - внешняя система ответила 500
+	ErrServerFatal = errors.New("SearchServer fatal error")
+)
+
+// сколько байт тела ответа попадает в DecodeError
+const decodeSnippetLen = 128
+
+// BadOrderFieldError - внешняя система не умеет сортировать по полю Field
+type BadOrderFieldError struct {
+	Field string
+}
+
+func (e *BadOrderFieldError) Error() string {
+	return fmt.Sprintf("OrderFeld %s invalid", e.Field)
+}
+
+// TimeoutError - запрос с параметрами Params не уложился в таймаут клиента
+type TimeoutError struct {
+	Params string
+	Err    error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timeout for %s", e.Params)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// TimeoutError можно проверять как net.Error
+var _ net.Error = (*TimeoutError)(nil)
+
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Temporary - повтор запроса может уложиться в таймаут
+func (e *TimeoutError) Temporary() bool {
+	return true
+}
+
+// DecodeError - не получилось разобрать json ответа, Kind - "result" для списка пользователей
+// или "error" для ответа с ошибкой, Body - начало тела ответа
+type DecodeError struct {
+	Kind string
+	Body string
+	Err  error
+}
+
+func newDecodeError(kind string, body []byte, err error) *DecodeError {
+	if len(body) > decodeSnippetLen {
+		body = body[:decodeSnippetLen]
+	}
+	return &DecodeError{Kind: kind, Body: string(body), Err: err}
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("cant unpack %s json: %s", e.Kind, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
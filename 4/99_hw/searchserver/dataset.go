@@ -0,0 +1,163 @@
+package searchserver
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// orderFields are the fields users can be sorted by, "" sorts by Name
+var orderFields = map[string]func(a, b User) int{
+	"Id":   func(a, b User) int { return cmp.Compare(a.Id, b.Id) },
+	"Name": func(a, b User) int { return cmp.Compare(a.Name, b.Name) },
+	"Age":  func(a, b User) int { return cmp.Compare(a.Age, b.Age) },
+}
+
+// dataset is immutable once built, a reload replaces it as a whole
+type dataset struct {
+	users []User
+	index trigramIndex
+	// asc and desc are the user indexes sorted by every order field, equal users keep the dataset order
+	asc  map[string][]int
+	desc map[string][]int
+	// asIs is the dataset order
+	asIs []int
+}
+
+func newDataset(rows []Row) *dataset {
+	d := &dataset{
+		users: make([]User, len(rows)),
+		asc:   make(map[string][]int, len(orderFields)),
+		desc:  make(map[string][]int, len(orderFields)),
+		asIs:  make([]int, len(rows)),
+	}
+	for i := range rows {
+		d.users[i] = rows[i].ToUser()
+		d.asIs[i] = i
+	}
+	d.index = newTrigramIndex(d.users)
+	for field, compare := range orderFields {
+		compare := compare
+		d.asc[field] = slices.Clone(d.asIs)
+		slices.SortStableFunc(d.asc[field], func(a, b int) int {
+			return compare(d.users[a], d.users[b])
+		})
+		d.desc[field] = slices.Clone(d.asIs)
+		slices.SortStableFunc(d.desc[field], func(a, b int) int {
+			return compare(d.users[b], d.users[a])
+		})
+	}
+	return d
+}
+
+func (d *dataset) order(field string, orderBy int) ([]int, error) {
+	if field == "" {
+		field = "Name"
+	}
+	if _, ok := orderFields[field]; !ok {
+		return nil, &BadRequestError{ErrorBadOrderField}
+	}
+	switch orderBy {
+	case OrderByAsc:
+		return d.asc[field], nil
+	case OrderByDesc:
+		return d.desc[field], nil
+	case OrderByAsIs:
+		return d.asIs, nil
+	}
+	return nil, &BadRequestError{"bad orderBy value, must be -1, 0 or 1"}
+}
+
+func (d *dataset) search(req Request) ([]User, error) {
+	order, err := d.order(req.OrderField, req.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+	if req.Limit < 0 {
+		return nil, &BadRequestError{"limit must be >= 0"}
+	}
+	if req.Offset < 0 {
+		return nil, &BadRequestError{"offset must be >= 0"}
+	}
+
+	matched := d.match(req.Query)
+	result := make([]User, 0, len(matched))
+	for _, i := range order {
+		if matched == nil || matched[i] {
+			result = append(result, d.users[i])
+		}
+	}
+	if req.Offset > len(result) {
+		return nil, &BadRequestError{"offset must be <= len(elems)"}
+	}
+	result = result[req.Offset:]
+	if req.Limit < len(result) {
+		result = result[:req.Limit]
+	}
+	return result, nil
+}
+
+// match returns the users with the query in Name or About, nil means all users
+func (d *dataset) match(query string) map[int]bool {
+	if query == "" {
+		return nil
+	}
+	matched := make(map[int]bool)
+	for _, i := range d.index.candidates(query, len(d.users)) {
+		u := d.users[i]
+		if strings.Contains(u.Name, query) || strings.Contains(u.About, query) {
+			matched[i] = true
+		}
+	}
+	return matched
+}
+
+// trigramIndex maps every three bytes met in Name or About to the sorted indexes of the users having them
+type trigramIndex map[string][]int
+
+func newTrigramIndex(users []User) trigramIndex {
+	index := make(trigramIndex)
+	for i, u := range users {
+		for _, s := range []string{u.Name, u.About} {
+			for j := 0; j+3 <= len(s); j++ {
+				trigram := s[j : j+3]
+				if postings := index[trigram]; len(postings) == 0 || postings[len(postings)-1] != i {
+					index[trigram] = append(postings, i)
+				}
+			}
+		}
+	}
+	return index
+}
+
+// candidates returns the users that may contain the query, all of them for queries shorter than a trigram
+func (index trigramIndex) candidates(query string, total int) []int {
+	if len(query) < 3 {
+		all := make([]int, total)
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+	result := index[query[:3]]
+	for j := 1; j+3 <= len(query) && len(result) > 0; j++ {
+		result = intersect(result, index[query[j:j+3]])
+	}
+	return result
+}
+
+func intersect(a, b []int) []int {
+	result := make([]int, 0, len(a))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			a = a[1:]
+		case a[0] > b[0]:
+			b = b[1:]
+		default:
+			result = append(result, a[0])
+			a, b = a[1:], b[1:]
+		}
+	}
+	return result
+}
@@ -0,0 +1,258 @@
+// Package searchserver is the search service behind SearchClient.
+// It keeps the users of an xml dataset in memory and reloads them when the file changes
+package searchserver
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OrderByAsc  = -1
+	OrderByAsIs = 0
+	OrderByDesc = 1
+
+	// ErrorBadOrderField is the Error of the response to an unknown order_field
+	ErrorBadOrderField = "ErrorBadOrderField"
+)
+
+type Root struct {
+	XMLName xml.Name `xml:"root"`
+	Rows    []Row    `xml:"row"`
+}
+
+type Row struct {
+	Id             int    `xml:"id"`
+	Guid           string `xml:"guid"`
+	IsActive       bool   `xml:"isActive"`
+	Balance        string `xml:"balance"`
+	PictureUrl     string `xml:"picture"`
+	Age            int    `xml:"age"`
+	EyeColor       string `xml:"eyeColor"`
+	FirstName      string `xml:"first_name"`
+	LastName       string `xml:"last_name"`
+	Gender         string `xml:"gender"`
+	Company        string `xml:"company"`
+	Email          string `xml:"email"`
+	Phone          string `xml:"phone"`
+	Address        string `xml:"address"`
+	About          string `xml:"about"`
+	Registered     string `xml:"registered"`
+	FavouriteFruit string `xml:"favourite_fruit"`
+}
+
+func (r Row) ToUser() User {
+	return User{
+		Id:     r.Id,
+		Name:   r.FirstName + " " + r.LastName,
+		Age:    r.Age,
+		About:  r.About,
+		Gender: r.Gender,
+	}
+}
+
+// User is what the server responds with, it's the same json as the client's User
+type User struct {
+	Id     int
+	Name   string
+	Age    int
+	About  string
+	Gender string
+}
+
+type ErrorResponse struct {
+	Error string
+}
+
+type Request struct {
+	Query      string
+	OrderField string
+	OrderBy    int
+	Limit      int
+	Offset     int
+}
+
+// BadRequestError is served as 400 with the message in ErrorResponse
+type BadRequestError struct {
+	Message string
+}
+
+func (e *BadRequestError) Error() string {
+	return e.Message
+}
+
+type Config struct {
+	// DatasetPath is the xml file with the users
+	DatasetPath string
+	// Tokens are the accepted AccessToken headers, any non-empty token is accepted if there are none
+	Tokens []string
+	// ReloadInterval is how often the dataset file is checked for changes, 0 checks it on every request
+	ReloadInterval time.Duration
+}
+
+type Server struct {
+	cfg    Config
+	tokens map[string]struct{}
+
+	mu   sync.RWMutex
+	data *dataset
+
+	// checkMu guards the fields of the last dataset file check
+	checkMu sync.Mutex
+	checked time.Time
+	modTime time.Time
+	size    int64
+}
+
+// New loads the dataset, it fails if the file can't be read or parsed
+func New(cfg Config) (*Server, error) {
+	s := &Server{cfg: cfg, tokens: make(map[string]struct{}, len(cfg.Tokens))}
+	for _, token := range cfg.Tokens {
+		s.tokens[token] = struct{}{}
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the dataset file unconditionally, the old users are kept if it fails
+func (s *Server) Reload() error {
+	s.checkMu.Lock()
+	defer s.checkMu.Unlock()
+	info, err := os.Stat(s.cfg.DatasetPath)
+	if err != nil {
+		return err
+	}
+	return s.load(info)
+}
+
+// load has to be called with checkMu locked
+func (s *Server) load(info os.FileInfo) error {
+	file, err := os.ReadFile(s.cfg.DatasetPath)
+	if err != nil {
+		return err
+	}
+	var root Root
+	if err := xml.Unmarshal(file, &root); err != nil {
+		return fmt.Errorf("cannot parse %s: %w", s.cfg.DatasetPath, err)
+	}
+	data := newDataset(root.Rows)
+
+	s.mu.Lock()
+	s.data = data
+	s.mu.Unlock()
+	s.checked, s.modTime, s.size = time.Now(), info.ModTime(), info.Size()
+	return nil
+}
+
+// refresh reloads the dataset if the file has changed since the last check
+func (s *Server) refresh() error {
+	s.checkMu.Lock()
+	defer s.checkMu.Unlock()
+	if time.Since(s.checked) < s.cfg.ReloadInterval {
+		return nil
+	}
+	s.checked = time.Now()
+	info, err := os.Stat(s.cfg.DatasetPath)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+	return s.load(info)
+}
+
+// Search returns the users of the current dataset, errors of the request params are *BadRequestError
+func (s *Server) Search(req Request) ([]User, error) {
+	s.mu.RLock()
+	data := s.data
+	s.mu.RUnlock()
+	return data.search(req)
+}
+
+func (s *Server) authorized(token string) bool {
+	if token == "" {
+		return false
+	}
+	if len(s.tokens) == 0 {
+		return true
+	}
+	_, ok := s.tokens[token]
+	return ok
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r.Header.Get("AccessToken")) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	req, err := parseRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	//a broken dataset file is retried on the next check, until then the old users are served
+	_ = s.refresh()
+
+	users, err := s.Search(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+func parseRequest(r *http.Request) (Request, error) {
+	errs := make([]string, 0, 3)
+	parseInt := func(name string) int {
+		value, err := strconv.Atoi(r.FormValue(name))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("could not parse %s: %s", name, err))
+		}
+		return value
+	}
+
+	req := Request{
+		Query:      r.FormValue("query"),
+		OrderField: r.FormValue("order_field"),
+		OrderBy:    parseInt("order_by"),
+		Limit:      parseInt("limit"),
+		Offset:     parseInt("offset"),
+	}
+	if len(errs) != 0 {
+		return req, &BadRequestError{strings.Join(errs, ";") + ";"}
+	}
+	return req, nil
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var badRequest *BadRequestError
+	if !errors.As(err, &badRequest) {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusBadRequest, ErrorResponse{badRequest.Message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
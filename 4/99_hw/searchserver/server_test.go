@@ -0,0 +1,217 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeDataset(t *testing.T, path string, rows ...Row) {
+	data, err := xml.Marshal(Root{Rows: rows})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(srv http.Handler, token string, query string) (int, string) {
+	r := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	r.Header.Set("AccessToken", token)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	return w.Code, strings.TrimSpace(w.Body.String())
+}
+
+func names(users []User) []string {
+	result := make([]string, len(users))
+	for i, u := range users {
+		result[i] = u.Name
+	}
+	return result
+}
+
+func TestSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	writeDataset(t, path,
+		Row{Id: 3, FirstName: "Carl", LastName: "Young", Age: 30, About: "likes tea"},
+		Row{Id: 1, FirstName: "Anna", LastName: "Old", Age: 40, About: "likes coffee"},
+		Row{Id: 2, FirstName: "Bob", LastName: "Young", Age: 30, About: "tea and coffee"},
+	)
+	srv, err := New(Config{DatasetPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		request  Request
+		expected []string
+		err      string
+	}{
+		{"as is", Request{OrderField: "Id", Limit: 10}, []string{"Carl Young", "Anna Old", "Bob Young"}, ""},
+		{"name by default", Request{OrderBy: OrderByAsc, Limit: 10}, []string{"Anna Old", "Bob Young", "Carl Young"}, ""},
+		{"id asc", Request{OrderField: "Id", OrderBy: OrderByAsc, Limit: 10}, []string{"Anna Old", "Bob Young", "Carl Young"}, ""},
+		{"age desc keeps ties", Request{OrderField: "Age", OrderBy: OrderByDesc, Limit: 10}, []string{"Anna Old", "Carl Young", "Bob Young"}, ""},
+		{"name desc", Request{OrderField: "Name", OrderBy: OrderByDesc, Limit: 10}, []string{"Carl Young", "Bob Young", "Anna Old"}, ""},
+		{"query in name", Request{Query: "Young", OrderBy: OrderByAsc, Limit: 10}, []string{"Bob Young", "Carl Young"}, ""},
+		{"query in about", Request{Query: "coffee", OrderBy: OrderByAsc, Limit: 10}, []string{"Anna Old", "Bob Young"}, ""},
+		{"short query", Request{Query: "ea", OrderBy: OrderByAsc, Limit: 10}, []string{"Bob Young", "Carl Young"}, ""},
+		{"no match", Request{Query: "milk", Limit: 10}, []string{}, ""},
+		{"offset and limit", Request{OrderBy: OrderByAsc, Offset: 1, Limit: 1}, []string{"Bob Young"}, ""},
+		{"offset at the end", Request{Offset: 3, Limit: 1}, []string{}, ""},
+		{"offset past the end", Request{Offset: 4, Limit: 1}, nil, "offset must be <= len(elems)"},
+		{"bad order field", Request{OrderField: "About"}, nil, ErrorBadOrderField},
+		{"bad order by", Request{OrderBy: 2}, nil, "bad orderBy value, must be -1, 0 or 1"},
+		{"bad limit", Request{Limit: -1}, nil, "limit must be >= 0"},
+	}
+
+	for _, tt := range tests {
+		users, err := srv.Search(tt.request)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("[%s] expected error %q, got %v", tt.name, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%s] unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got := names(users); !slices.Equal(got, tt.expected) {
+			t.Errorf("[%s] expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestIndexMatchesScan(t *testing.T) {
+	srv, err := New(Config{DatasetPath: "../dataset.xml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := srv.Search(Request{Limit: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries := []string{"a", "Bo", "Boy", "Boyd Wolf", "ipsum", "Ipsum", "est.", "non ", "velit  ", "zzz"}
+	for _, u := range all {
+		queries = append(queries, u.Name[1:], u.About[len(u.About)/2:len(u.About)/2+7])
+	}
+
+	for _, query := range queries {
+		expected := []User{}
+		for _, u := range all {
+			if strings.Contains(u.Name, query) || strings.Contains(u.About, query) {
+				expected = append(expected, u)
+			}
+		}
+		found, err := srv.Search(Request{Query: query, Limit: 1000})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(found, expected) {
+			t.Errorf("query %q: expected %v, got %v", query, names(expected), names(found))
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	writeDataset(t, path, Row{Id: 1, FirstName: "Anna", LastName: "Old", Age: 40})
+	srv, err := New(Config{DatasetPath: path, Tokens: []string{"first", "second"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		query  string
+		status int
+		body   string
+	}{
+		{"no token", "", "limit=1&offset=0&order_by=0", http.StatusUnauthorized, ""},
+		{"unknown token", "third", "limit=1&offset=0&order_by=0", http.StatusUnauthorized, ""},
+		{"ok", "second", "limit=1&offset=0&order_by=0", http.StatusOK, `[{"Id":1,"Name":"Anna Old","Age":40,"About":"","Gender":""}]`},
+		{"bad params", "first", "limit=x&offset=0", http.StatusBadRequest,
+			`{"Error":"could not parse order_by: strconv.Atoi: parsing \"\": invalid syntax;could not parse limit: strconv.Atoi: parsing \"x\": invalid syntax;"}`},
+		{"bad order field", "first", "limit=1&offset=0&order_by=0&order_field=Age2", http.StatusBadRequest, `{"Error":"ErrorBadOrderField"}`},
+	}
+
+	for _, tt := range tests {
+		status, body := get(srv, tt.token, tt.query)
+		if status != tt.status || body != tt.body {
+			t.Errorf("[%s] expected %d %s, got %d %s", tt.name, tt.status, tt.body, status, body)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	writeDataset(t, path, Row{Id: 1, FirstName: "Anna", LastName: "Old"})
+	srv, err := New(Config{DatasetPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	search := func() []string {
+		_, body := get(srv, "token", "limit=10&offset=0&order_by=0")
+		var users []User
+		if err := json.Unmarshal([]byte(body), &users); err != nil {
+			t.Fatalf("bad response %q: %v", body, err)
+		}
+		return names(users)
+	}
+
+	writeDataset(t, path, Row{Id: 1, FirstName: "Anna", LastName: "Old"}, Row{Id: 2, FirstName: "Bob", LastName: "Young"})
+	//the size changes, so the reload doesn't depend on the mtime resolution
+	if got := search(); !slices.Equal(got, []string{"Anna Old", "Bob Young"}) {
+		t.Errorf("expected the reloaded users, got %v", got)
+	}
+
+	//a broken file keeps the old users
+	if err := os.WriteFile(path, []byte("<root><row>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := search(); !slices.Equal(got, []string{"Anna Old", "Bob Young"}) {
+		t.Errorf("expected the old users, got %v", got)
+	}
+
+	writeDataset(t, path, Row{Id: 3, FirstName: "Carl", LastName: "Young"})
+	if got := search(); !slices.Equal(got, []string{"Carl Young"}) {
+		t.Errorf("expected the fixed users, got %v", got)
+	}
+}
+
+func TestReloadInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	writeDataset(t, path, Row{Id: 1, FirstName: "Anna", LastName: "Old"})
+	srv, err := New(Config{DatasetPath: path, ReloadInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeDataset(t, path, Row{Id: 2, FirstName: "Bob", LastName: "Young"})
+	if _, body := get(srv, "token", "limit=10&offset=0&order_by=0"); !strings.Contains(body, "Anna Old") {
+		t.Errorf("the dataset is reloaded before the interval: %s", body)
+	}
+	if err := srv.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, body := get(srv, "token", "limit=10&offset=0&order_by=0"); !strings.Contains(body, "Bob Young") {
+		t.Errorf("the dataset is not reloaded: %s", body)
+	}
+}
+
+func TestNewFails(t *testing.T) {
+	if _, err := New(Config{DatasetPath: filepath.Join(t.TempDir(), "missing.xml")}); err == nil {
+		t.Error("expected an error for a missing dataset")
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
+//go:generate go run ./handlers_gen -client apiclient -o api_gen.go .
+
 import (
 	"context"
 	"fmt"
 	"net/http"
 	"sync"
+	"time"
 )
 
 // вы можете использовать ApiError в коде, который получается в результате генерации
@@ -153,3 +156,127 @@ func (srv *OtherApi) Create(ctx context.Context, in OtherCreateParams) (*OtherUs
 		Level:    in.Level,
 	}, nil
 }
+
+// 3-я часть
+// параметры других типов и из других источников: path, query, header и json-тело запроса
+
+type ItemsApi struct {
+}
+
+func NewItemsApi() *ItemsApi {
+	return &ItemsApi{}
+}
+
+type ItemParams struct {
+	ID        int       `apivalidator:"from=path,paramname=id,min=1"`
+	Available bool      `apivalidator:"default=true"`
+	Price     float64   `apivalidator:"min=0.5,max=1000"`
+	Since     time.Time `apivalidator:"paramname=since"`
+	Tags      []string  `apivalidator:"paramname=tag,min=2"`
+	Sizes     []int     `apivalidator:"from=query,paramname=size,enum=36|38|40"`
+	Token     string    `apivalidator:"from=header,paramname=X-Token,required"`
+}
+
+type Dimensions struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+type StoreParams struct {
+	Title      string     `apivalidator:"from=body,paramname=title,required,min=3"`
+	Dimensions Dimensions `apivalidator:"paramname=dimensions,required"`
+	Colors     []string   `apivalidator:"from=body,paramname=colors,enum=red|green|blue"`
+	Count      int        `apivalidator:"from=body,paramname=count,default=1,max=10"`
+}
+
+type Item struct {
+	ID         int        `json:"id"`
+	Available  bool       `json:"available"`
+	Price      float64    `json:"price"`
+	Since      time.Time  `json:"since"`
+	Tags       []string   `json:"tags"`
+	Sizes      []int      `json:"sizes"`
+	Title      string     `json:"title,omitempty"`
+	Dimensions Dimensions `json:"dimensions"`
+	Colors     []string   `json:"colors,omitempty"`
+	Count      int        `json:"count,omitempty"`
+}
+
+// apigen:api {"url": "/items/{id}", "auth": false, "method": "GET"}
+func (srv *ItemsApi) Item(ctx context.Context, in ItemParams) (*Item, error) {
+	return &Item{
+		ID:        in.ID,
+		Available: in.Available,
+		Price:     in.Price,
+		Since:     in.Since,
+		Tags:      in.Tags,
+		Sizes:     in.Sizes,
+	}, nil
+}
+
+// apigen:api {"url": "/items", "auth": false, "method": "POST"}
+func (srv *ItemsApi) Store(ctx context.Context, in StoreParams) (*Item, error) {
+	return &Item{
+		ID:         1,
+		Title:      in.Title,
+		Dimensions: in.Dimensions,
+		Colors:     in.Colors,
+		Count:      in.Count,
+	}, nil
+}
+
+type FindParams struct {
+	Title string `apivalidator:"from=path,paramname=title,required"`
+}
+
+// apigen:api {"url": "/items/find/{title}", "auth": false, "method": "GET"}
+func (srv *ItemsApi) Find(ctx context.Context, in FindParams) (*Item, error) {
+	return &Item{Title: in.Title}, nil
+}
+
+type ReserveParams struct {
+	Email  string    `apivalidator:"required,email"`
+	Order  string    `apivalidator:"paramname=order_id,uuid"`
+	Pin    string    `apivalidator:"required,len=4"`
+	Guests int       `apivalidator:"default=2,oneof=1 2 4"`
+	From   time.Time `apivalidator:"required"`
+	Till   time.Time `apivalidator:"required,gtfield=From"`
+	Code   string    `apivalidator:"paramname=promo_code,regexp=^[A-Z]{2,4}-[0-9]{1,3}$"`
+}
+
+type Reservation struct {
+	Email  string `json:"email"`
+	Order  string `json:"order_id"`
+	Guests int    `json:"guests"`
+	Nights int    `json:"nights"`
+	Code   string `json:"promo_code"`
+}
+
+// apigen:api {"url": "/items/reserve", "auth": false, "method": "POST"}
+func (srv *ItemsApi) Reserve(ctx context.Context, in ReserveParams) (*Reservation, error) {
+	return &Reservation{
+		Email:  in.Email,
+		Order:  in.Order,
+		Guests: in.Guests,
+		Nights: int(in.Till.Sub(in.From).Hours() / 24),
+		Code:   in.Code,
+	}, nil
+}
+
+type DeleteParams struct {
+	ID int `apivalidator:"from=path,paramname=id,min=1"`
+}
+
+type Deleted struct {
+	ID int    `json:"id"`
+	By string `json:"by"`
+}
+
+// apigen:api {"url": "/items/{id}", "auth": "bearer", "auth_scheme": "bearer", "method": "DELETE", "middleware": ["request-id", "audit"]}
+func (srv *ItemsApi) Delete(ctx context.Context, in DeleteParams) (*Deleted, error) {
+	principal, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("no principal")
+	}
+	return &Deleted{ID: in.ID, By: fmt.Sprint(principal)}, nil
+}
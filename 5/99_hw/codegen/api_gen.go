@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 var (
@@ -25,23 +33,62 @@ func (r httpResponse) write(w http.ResponseWriter, status int) {
 	_, _ = w.Write(marshal)
 }
 
+// validationError lists every failed check of the params
+type validationError []string
+
+func (e validationError) Error() string {
+	return strings.Join(e, "; ")
+}
+
 func auth(r *http.Request) bool {
 	return r.Header.Get("X-Auth") == "100500"
 }
 
-func (srv *MyApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.URL.Path {
-	case "/user/create":
+func (srv *ItemsApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	paths := pathMatcher{r: r}
+	switch {
+	case r.URL.Path == "/openapi.json":
+		if r.Method != http.MethodGet {
+			httpResponse{Err: errStatusNotAcceptable.Error()}.write(w, http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, openapiItemsApi)
+	case r.URL.Path == "/items":
 		switch r.Method {
 		case "POST":
-			srv.wrapperCreate(w, r)
+			srv.wrapperStore(w, r)
+		default:
+			httpResponse{Err: errStatusNotAcceptable.Error()}.write(w, http.StatusNotAcceptable)
+		}
+	case r.URL.Path == "/items/reserve":
+		switch r.Method {
+		case "POST":
+			srv.wrapperReserve(w, r)
 		default:
 			httpResponse{Err: errStatusNotAcceptable.Error()}.write(w, http.StatusNotAcceptable)
 		}
-	case "/user/profile":
+	case paths.match("/items/find/{title}"):
+		if paths.err != nil {
+			httpResponse{Err: paths.err.Error()}.write(w, http.StatusBadRequest)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			srv.wrapperFind(w, r)
+		default:
+			httpResponse{Err: errStatusNotAcceptable.Error()}.write(w, http.StatusNotAcceptable)
+		}
+	case paths.match("/items/{id}"):
+		if paths.err != nil {
+			httpResponse{Err: paths.err.Error()}.write(w, http.StatusBadRequest)
+			return
+		}
 		switch r.Method {
+		case "DELETE":
+			srv.wrapperDelete(w, r)
 		case "GET":
-			srv.wrapperProfile(w, r)
+			srv.wrapperItem(w, r)
 		default:
 			httpResponse{Err: errStatusNotAcceptable.Error()}.write(w, http.StatusNotAcceptable)
 		}
@@ -50,19 +97,918 @@ func (srv *MyApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (srv *MyApi) wrapperCreate(w http.ResponseWriter, r *http.Request) {
-	if authorized := auth(r); !authorized {
+// openapiItemsApi is the OpenAPI document of the handlers above
+const openapiItemsApi = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "ItemsApi",
+    "version": "1.0.0"
+  },
+  "paths": {
+    "/items": {
+      "post": {
+        "operationId": "Store",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "colors": {
+                    "type": "array",
+                    "items": {
+                      "type": "string",
+                      "enum": [
+                        "red",
+                        "green",
+                        "blue"
+                      ]
+                    }
+                  },
+                  "count": {
+                    "type": "integer",
+                    "default": 1,
+                    "maximum": 10
+                  },
+                  "dimensions": {
+                    "$ref": "#/components/schemas/Dimensions"
+                  },
+                  "title": {
+                    "type": "string",
+                    "minLength": 3
+                  }
+                },
+                "required": [
+                  "title",
+                  "dimensions"
+                ]
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "OK",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "error": {
+                      "type": "string"
+                    },
+                    "response": {
+                      "$ref": "#/components/schemas/Item"
+                    }
+                  },
+                  "required": [
+                    "error"
+                  ]
+                }
+              }
+            }
+          },
+          "400": {
+            "description": "Invalid params, all the failed checks joined with \"; \"",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          },
+          "default": {
+            "description": "Error of the method",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          }
+        }
+      }
+    },
+    "/items/find/{title}": {
+      "get": {
+        "operationId": "Find",
+        "parameters": [
+          {
+            "name": "title",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "OK",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "error": {
+                      "type": "string"
+                    },
+                    "response": {
+                      "$ref": "#/components/schemas/Item"
+                    }
+                  },
+                  "required": [
+                    "error"
+                  ]
+                }
+              }
+            }
+          },
+          "400": {
+            "description": "Invalid params, all the failed checks joined with \"; \"",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          },
+          "default": {
+            "description": "Error of the method",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          }
+        }
+      }
+    },
+    "/items/reserve": {
+      "post": {
+        "operationId": "Reserve",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "email": {
+                    "type": "string",
+                    "format": "email"
+                  },
+                  "from": {
+                    "type": "string",
+                    "format": "date-time"
+                  },
+                  "guests": {
+                    "type": "integer",
+                    "enum": [
+                      1,
+                      2,
+                      4
+                    ],
+                    "default": 2
+                  },
+                  "order_id": {
+                    "type": "string",
+                    "format": "uuid"
+                  },
+                  "pin": {
+                    "type": "string",
+                    "minLength": 4,
+                    "maxLength": 4
+                  },
+                  "promo_code": {
+                    "type": "string",
+                    "pattern": "^[A-Z]{2,4}-[0-9]{1,3}$"
+                  },
+                  "till": {
+                    "type": "string",
+                    "format": "date-time"
+                  }
+                },
+                "required": [
+                  "email",
+                  "pin",
+                  "from",
+                  "till"
+                ]
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "OK",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "error": {
+                      "type": "string"
+                    },
+                    "response": {
+                      "$ref": "#/components/schemas/Reservation"
+                    }
+                  },
+                  "required": [
+                    "error"
+                  ]
+                }
+              }
+            }
+          },
+          "400": {
+            "description": "Invalid params, all the failed checks joined with \"; \"",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          },
+          "default": {
+            "description": "Error of the method",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          }
+        }
+      }
+    },
+    "/items/{id}": {
+      "delete": {
+        "operationId": "Delete",
+        "security": [
+          {
+            "bearer": []
+          }
+        ],
+        "parameters": [
+          {
+            "name": "id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer",
+              "minimum": 1
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "OK",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "error": {
+                      "type": "string"
+                    },
+                    "response": {
+                      "$ref": "#/components/schemas/Deleted"
+                    }
+                  },
+                  "required": [
+                    "error"
+                  ]
+                }
+              }
+            }
+          },
+          "400": {
+            "description": "Invalid params, all the failed checks joined with \"; \"",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          },
+          "403": {
+            "description": "Unauthorized",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          },
+          "default": {
+            "description": "Error of the method",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          }
+        }
+      },
+      "get": {
+        "operationId": "Item",
+        "parameters": [
+          {
+            "name": "id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer",
+              "minimum": 1
+            }
+          },
+          {
+            "name": "available",
+            "in": "query",
+            "schema": {
+              "type": "boolean",
+              "default": true
+            }
+          },
+          {
+            "name": "price",
+            "in": "query",
+            "schema": {
+              "type": "number",
+              "format": "double",
+              "minimum": 0.5,
+              "maximum": 1000
+            }
+          },
+          {
+            "name": "since",
+            "in": "query",
+            "schema": {
+              "type": "string",
+              "format": "date-time"
+            }
+          },
+          {
+            "name": "tag",
+            "in": "query",
+            "schema": {
+              "type": "array",
+              "items": {
+                "type": "string",
+                "minLength": 2
+              }
+            }
+          },
+          {
+            "name": "size",
+            "in": "query",
+            "schema": {
+              "type": "array",
+              "items": {
+                "type": "integer",
+                "enum": [
+                  36,
+                  38,
+                  40
+                ]
+              }
+            }
+          },
+          {
+            "name": "X-Token",
+            "in": "header",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "OK",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "error": {
+                      "type": "string"
+                    },
+                    "response": {
+                      "$ref": "#/components/schemas/Item"
+                    }
+                  },
+                  "required": [
+                    "error"
+                  ]
+                }
+              }
+            }
+          },
+          "400": {
+            "description": "Invalid params, all the failed checks joined with \"; \"",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          },
+          "default": {
+            "description": "Error of the method",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "Deleted": {
+        "type": "object",
+        "properties": {
+          "by": {
+            "type": "string"
+          },
+          "id": {
+            "type": "integer"
+          }
+        },
+        "required": [
+          "by",
+          "id"
+        ]
+      },
+      "Dimensions": {
+        "type": "object",
+        "properties": {
+          "height": {
+            "type": "number"
+          },
+          "width": {
+            "type": "number"
+          }
+        },
+        "required": [
+          "height",
+          "width"
+        ]
+      },
+      "Error": {
+        "type": "object",
+        "properties": {
+          "error": {
+            "type": "string"
+          }
+        },
+        "required": [
+          "error"
+        ]
+      },
+      "Item": {
+        "type": "object",
+        "properties": {
+          "available": {
+            "type": "boolean"
+          },
+          "colors": {
+            "type": "array",
+            "items": {
+              "type": "string"
+            }
+          },
+          "count": {
+            "type": "integer"
+          },
+          "dimensions": {
+            "$ref": "#/components/schemas/Dimensions"
+          },
+          "id": {
+            "type": "integer"
+          },
+          "price": {
+            "type": "number"
+          },
+          "since": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "sizes": {
+            "type": "array",
+            "items": {
+              "type": "integer"
+            }
+          },
+          "tags": {
+            "type": "array",
+            "items": {
+              "type": "string"
+            }
+          },
+          "title": {
+            "type": "string"
+          }
+        },
+        "required": [
+          "available",
+          "dimensions",
+          "id",
+          "price",
+          "since",
+          "sizes",
+          "tags"
+        ]
+      },
+      "Reservation": {
+        "type": "object",
+        "properties": {
+          "email": {
+            "type": "string"
+          },
+          "guests": {
+            "type": "integer"
+          },
+          "nights": {
+            "type": "integer"
+          },
+          "order_id": {
+            "type": "string"
+          },
+          "promo_code": {
+            "type": "string"
+          }
+        },
+        "required": [
+          "email",
+          "guests",
+          "nights",
+          "order_id",
+          "promo_code"
+        ]
+      }
+    },
+    "securitySchemes": {
+      "bearer": {
+        "type": "http",
+        "description": "Checked by the authenticator registered as \"bearer\"",
+        "scheme": "bearer"
+      }
+    }
+  }
+}`
+
+func (srv *ItemsApi) wrapperStore(w http.ResponseWriter, r *http.Request) {
+	in, err := getAndValidateStoreParams(r)
+	if err != nil {
+		httpResponse{Err: err.Error()}.write(w, http.StatusBadRequest)
+		return
+	}
+
+	result, err := srv.Store(r.Context(), in)
+	if err != nil {
+		var ae ApiError
+		if errors.As(err, &ae) {
+			httpResponse{Err: ae.Error()}.write(w, ae.HTTPStatus)
+			return
+		}
+		httpResponse{Err: err.Error()}.write(w, http.StatusInternalServerError)
+		return
+	}
+
+	httpResponse{Response: result}.write(w, http.StatusOK)
+}
+
+// getAndValidateStoreParams checks every field and returns all the failed checks at once
+func getAndValidateStoreParams(r *http.Request) (StoreParams, error) {
+	if err := r.ParseForm(); err != nil {
+		return StoreParams{}, err
+	}
+	body := map[string]json.RawMessage{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		return StoreParams{}, fmt.Errorf("body must be a json object")
+	}
+
+	var errs validationError
+	var fieldTitle string
+	if err := func() error {
+		if raw, ok := body["title"]; ok && string(raw) != "null" {
+			if err := json.Unmarshal(raw, &fieldTitle); err != nil {
+				return fmt.Errorf("title must be string")
+			}
+		} else {
+			return fmt.Errorf("title must me not empty")
+		}
+		if len(fieldTitle) < 3 {
+			return fmt.Errorf("title len must be >= 3")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var fieldDimensions Dimensions
+	if err := func() error {
+		if raw, ok := body["dimensions"]; ok && string(raw) != "null" {
+			if err := json.Unmarshal(raw, &fieldDimensions); err != nil {
+				return fmt.Errorf("dimensions must be Dimensions")
+			}
+		} else {
+			return fmt.Errorf("dimensions must me not empty")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var fieldColors []string
+	if err := func() error {
+		if raw, ok := body["colors"]; ok && string(raw) != "null" {
+			if err := json.Unmarshal(raw, &fieldColors); err != nil {
+				return fmt.Errorf("colors must be list of string")
+			}
+		}
+		for _, fieldColorsItem := range fieldColors {
+			switch fieldColorsItem {
+			case "red", "green", "blue":
+			default:
+				return fmt.Errorf("colors must be one of [red, green, blue]")
+			}
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var fieldCount int
+	if err := func() error {
+		if raw, ok := body["count"]; ok && string(raw) != "null" {
+			if err := json.Unmarshal(raw, &fieldCount); err != nil {
+				return fmt.Errorf("count must be int")
+			}
+		} else {
+			fieldCount = 1
+		}
+		if fieldCount > 10 {
+			return fmt.Errorf("count must be <= 10")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return StoreParams{}, errs
+	}
+
+	in := StoreParams{
+		Title:      fieldTitle,
+		Dimensions: fieldDimensions,
+		Colors:     fieldColors,
+		Count:      fieldCount,
+	}
+
+	return in, nil
+}
+
+func (srv *ItemsApi) wrapperFind(w http.ResponseWriter, r *http.Request) {
+	in, err := getAndValidateFindParams(r)
+	if err != nil {
+		httpResponse{Err: err.Error()}.write(w, http.StatusBadRequest)
+		return
+	}
+
+	result, err := srv.Find(r.Context(), in)
+	if err != nil {
+		var ae ApiError
+		if errors.As(err, &ae) {
+			httpResponse{Err: ae.Error()}.write(w, ae.HTTPStatus)
+			return
+		}
+		httpResponse{Err: err.Error()}.write(w, http.StatusInternalServerError)
+		return
+	}
+
+	httpResponse{Response: result}.write(w, http.StatusOK)
+}
+
+// getAndValidateFindParams checks every field and returns all the failed checks at once
+func getAndValidateFindParams(r *http.Request) (FindParams, error) {
+	if err := r.ParseForm(); err != nil {
+		return FindParams{}, err
+	}
+
+	var errs validationError
+	var fieldTitle string
+	if err := func() error {
+		fieldTitle = r.PathValue("title")
+		if fieldTitle == "" {
+			return fmt.Errorf("title must me not empty")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return FindParams{}, errs
+	}
+
+	in := FindParams{
+		Title: fieldTitle,
+	}
+
+	return in, nil
+}
+
+func (srv *ItemsApi) wrapperReserve(w http.ResponseWriter, r *http.Request) {
+	in, err := getAndValidateReserveParams(r)
+	if err != nil {
+		httpResponse{Err: err.Error()}.write(w, http.StatusBadRequest)
+		return
+	}
+
+	result, err := srv.Reserve(r.Context(), in)
+	if err != nil {
+		var ae ApiError
+		if errors.As(err, &ae) {
+			httpResponse{Err: ae.Error()}.write(w, ae.HTTPStatus)
+			return
+		}
+		httpResponse{Err: err.Error()}.write(w, http.StatusInternalServerError)
+		return
+	}
+
+	httpResponse{Response: result}.write(w, http.StatusOK)
+}
+
+var reserveParamsCodeRegexp = regexp.MustCompile("^[A-Z]{2,4}-[0-9]{1,3}$")
+
+// getAndValidateReserveParams checks every field and returns all the failed checks at once
+func getAndValidateReserveParams(r *http.Request) (ReserveParams, error) {
+	if err := r.ParseForm(); err != nil {
+		return ReserveParams{}, err
+	}
+
+	var errs validationError
+	var fieldEmail string
+	if err := func() error {
+		fieldEmail = r.Form.Get("email")
+		if fieldEmail == "" {
+			return fmt.Errorf("email must me not empty")
+		}
+		if !isEmail(fieldEmail) {
+			return fmt.Errorf("email must be email")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var fieldOrder string
+	if err := func() error {
+		fieldOrder = r.Form.Get("order_id")
+		if fieldOrder != "" && !uuidRegexp.MatchString(fieldOrder) {
+			return fmt.Errorf("order_id must be uuid")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var fieldPin string
+	if err := func() error {
+		fieldPin = r.Form.Get("pin")
+		if fieldPin == "" {
+			return fmt.Errorf("pin must me not empty")
+		}
+		if len(fieldPin) != 4 {
+			return fmt.Errorf("pin len must be 4")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var fieldGuests int
+	if err := func() error {
+		rawGuests := r.Form.Get("guests")
+		if rawGuests == "" {
+			rawGuests = "2"
+		}
+		parsed, err := strconv.Atoi(rawGuests)
+		if err != nil {
+			return fmt.Errorf("guests must be int")
+		}
+		fieldGuests = parsed
+		switch fieldGuests {
+		case 1, 2, 4:
+		default:
+			return fmt.Errorf("guests must be one of [1, 2, 4]")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var fieldFrom time.Time
+	if err := func() error {
+		rawFrom := r.Form.Get("from")
+		if rawFrom == "" {
+			return fmt.Errorf("from must me not empty")
+		}
+		parsed, err := time.Parse(time.RFC3339, rawFrom)
+		if err != nil {
+			return fmt.Errorf("from must be time in RFC3339 format")
+		}
+		fieldFrom = parsed
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var fieldTill time.Time
+	if err := func() error {
+		rawTill := r.Form.Get("till")
+		if rawTill == "" {
+			return fmt.Errorf("till must me not empty")
+		}
+		parsed, err := time.Parse(time.RFC3339, rawTill)
+		if err != nil {
+			return fmt.Errorf("till must be time in RFC3339 format")
+		}
+		fieldTill = parsed
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var fieldCode string
+	if err := func() error {
+		fieldCode = r.Form.Get("promo_code")
+		if fieldCode != "" && !reserveParamsCodeRegexp.MatchString(fieldCode) {
+			return errors.New("promo_code must match ^[A-Z]{2,4}-[0-9]{1,3}$")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) == 0 {
+		if !(fieldTill.After(fieldFrom)) {
+			errs = append(errs, "till must be greater than from")
+		}
+	}
+	if len(errs) > 0 {
+		return ReserveParams{}, errs
+	}
+
+	in := ReserveParams{
+		Email:  fieldEmail,
+		Order:  fieldOrder,
+		Pin:    fieldPin,
+		Guests: fieldGuests,
+		From:   fieldFrom,
+		Till:   fieldTill,
+		Code:   fieldCode,
+	}
+
+	return in, nil
+}
+
+func (srv *ItemsApi) wrapperDelete(w http.ResponseWriter, r *http.Request) {
+	serveWithMiddleware(w, r, "ItemsApi.Delete", http.HandlerFunc(srv.wrapperDeleteHandler), "request-id", "audit")
+}
+
+func (srv *ItemsApi) wrapperDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	r, err := authenticate(r, "bearer")
+	if err != nil {
+		var ae ApiError
+		if errors.As(err, &ae) {
+			httpResponse{Err: ae.Error()}.write(w, ae.HTTPStatus)
+			return
+		}
 		httpResponse{Err: errUnauthorized.Error()}.write(w, http.StatusForbidden)
 		return
 	}
 
-	in, err := getAndValidateCreateParams(r)
+	in, err := getAndValidateDeleteParams(r)
 	if err != nil {
 		httpResponse{Err: err.Error()}.write(w, http.StatusBadRequest)
 		return
 	}
 
-	result, err := srv.Create(r.Context(), in)
+	result, err := srv.Delete(r.Context(), in)
 	if err != nil {
 		var ae ApiError
 		if errors.As(err, &ae) {
@@ -76,49 +1022,602 @@ func (srv *MyApi) wrapperCreate(w http.ResponseWriter, r *http.Request) {
 	httpResponse{Response: result}.write(w, http.StatusOK)
 }
 
-func getAndValidateCreateParams(r *http.Request) (CreateParams, error) {
+// getAndValidateDeleteParams checks every field and returns all the failed checks at once
+func getAndValidateDeleteParams(r *http.Request) (DeleteParams, error) {
 	if err := r.ParseForm(); err != nil {
-		return CreateParams{}, err
+		return DeleteParams{}, err
 	}
 
-	login := r.Form.Get("login")
-	if login == "" {
-		return CreateParams{}, fmt.Errorf("login must me not empty")
+	var errs validationError
+	var fieldID int
+	if err := func() error {
+		rawID := r.PathValue("id")
+		if rawID != "" {
+			parsed, err := strconv.Atoi(rawID)
+			if err != nil {
+				return fmt.Errorf("id must be int")
+			}
+			fieldID = parsed
+		}
+		if fieldID < 1 {
+			return fmt.Errorf("id must be >= 1")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
 	}
-	if len(login) < 10 {
-		return CreateParams{}, fmt.Errorf("login len must be >= 10")
+
+	if len(errs) > 0 {
+		return DeleteParams{}, errs
 	}
-	name := r.Form.Get("full_name")
-	status := r.Form.Get("status")
-	if status == "" {
-		status = "user"
+
+	in := DeleteParams{
+		ID: fieldID,
 	}
-	switch status {
-	case "user", "moderator", "admin":
+
+	return in, nil
+}
+
+func (srv *ItemsApi) wrapperItem(w http.ResponseWriter, r *http.Request) {
+	in, err := getAndValidateItemParams(r)
+	if err != nil {
+		httpResponse{Err: err.Error()}.write(w, http.StatusBadRequest)
+		return
+	}
+
+	result, err := srv.Item(r.Context(), in)
+	if err != nil {
+		var ae ApiError
+		if errors.As(err, &ae) {
+			httpResponse{Err: ae.Error()}.write(w, ae.HTTPStatus)
+			return
+		}
+		httpResponse{Err: err.Error()}.write(w, http.StatusInternalServerError)
+		return
+	}
+
+	httpResponse{Response: result}.write(w, http.StatusOK)
+}
+
+// getAndValidateItemParams checks every field and returns all the failed checks at once
+func getAndValidateItemParams(r *http.Request) (ItemParams, error) {
+	if err := r.ParseForm(); err != nil {
+		return ItemParams{}, err
+	}
+
+	var errs validationError
+	var fieldID int
+	if err := func() error {
+		rawID := r.PathValue("id")
+		if rawID != "" {
+			parsed, err := strconv.Atoi(rawID)
+			if err != nil {
+				return fmt.Errorf("id must be int")
+			}
+			fieldID = parsed
+		}
+		if fieldID < 1 {
+			return fmt.Errorf("id must be >= 1")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var fieldAvailable bool
+	if err := func() error {
+		rawAvailable := r.Form.Get("available")
+		if rawAvailable == "" {
+			rawAvailable = "true"
+		}
+		parsed, err := strconv.ParseBool(rawAvailable)
+		if err != nil {
+			return fmt.Errorf("available must be bool")
+		}
+		fieldAvailable = parsed
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var fieldPrice float64
+	if err := func() error {
+		rawPrice := r.Form.Get("price")
+		if rawPrice != "" {
+			parsed, err := strconv.ParseFloat(rawPrice, 64)
+			if err != nil {
+				return fmt.Errorf("price must be float64")
+			}
+			fieldPrice = parsed
+		}
+		if fieldPrice < 0.5 {
+			return fmt.Errorf("price must be >= 0.5")
+		}
+		if fieldPrice > 1000 {
+			return fmt.Errorf("price must be <= 1000")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var fieldSince time.Time
+	if err := func() error {
+		rawSince := r.Form.Get("since")
+		if rawSince != "" {
+			parsed, err := time.Parse(time.RFC3339, rawSince)
+			if err != nil {
+				return fmt.Errorf("since must be time in RFC3339 format")
+			}
+			fieldSince = parsed
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var fieldTags []string
+	if err := func() error {
+		rawTags := r.Form["tag"]
+		fieldTags = rawTags
+		for _, fieldTagsItem := range fieldTags {
+			if len(fieldTagsItem) < 2 {
+				return fmt.Errorf("tag len must be >= 2")
+			}
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var fieldSizes []int
+	if err := func() error {
+		rawSizes := r.URL.Query()["size"]
+		fieldSizes = make([]int, 0, len(rawSizes))
+		for _, rawItem := range rawSizes {
+			parsedItem, err := strconv.Atoi(rawItem)
+			if err != nil {
+				return fmt.Errorf("size must be list of int")
+			}
+			fieldSizes = append(fieldSizes, parsedItem)
+		}
+		for _, fieldSizesItem := range fieldSizes {
+			switch fieldSizesItem {
+			case 36, 38, 40:
+			default:
+				return fmt.Errorf("size must be one of [36, 38, 40]")
+			}
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var fieldToken string
+	if err := func() error {
+		fieldToken = r.Header.Get("X-Token")
+		if fieldToken == "" {
+			return fmt.Errorf("X-Token must me not empty")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return ItemParams{}, errs
+	}
+
+	in := ItemParams{
+		ID:        fieldID,
+		Available: fieldAvailable,
+		Price:     fieldPrice,
+		Since:     fieldSince,
+		Tags:      fieldTags,
+		Sizes:     fieldSizes,
+		Token:     fieldToken,
+	}
+
+	return in, nil
+}
+
+func (srv *MyApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/openapi.json":
+		if r.Method != http.MethodGet {
+			httpResponse{Err: errStatusNotAcceptable.Error()}.write(w, http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, openapiMyApi)
+	case r.URL.Path == "/user/create":
+		switch r.Method {
+		case "POST":
+			srv.wrapperCreate(w, r)
+		default:
+			httpResponse{Err: errStatusNotAcceptable.Error()}.write(w, http.StatusNotAcceptable)
+		}
+	case r.URL.Path == "/user/profile":
+		srv.wrapperProfile(w, r)
 	default:
-		return CreateParams{}, fmt.Errorf("status must be one of [user, moderator, admin]")
+		httpResponse{Err: errNotFound.Error()}.write(w, http.StatusNotFound)
+	}
+}
+
+// openapiMyApi is the OpenAPI document of the handlers above
+const openapiMyApi = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "MyApi",
+    "version": "1.0.0"
+  },
+  "paths": {
+    "/user/create": {
+      "post": {
+        "operationId": "Create",
+        "security": [
+          {
+            "apiKey": []
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "age": {
+                    "type": "integer",
+                    "minimum": 0,
+                    "maximum": 128
+                  },
+                  "full_name": {
+                    "type": "string"
+                  },
+                  "login": {
+                    "type": "string",
+                    "minLength": 10
+                  },
+                  "status": {
+                    "type": "string",
+                    "enum": [
+                      "user",
+                      "moderator",
+                      "admin"
+                    ],
+                    "default": "user"
+                  }
+                },
+                "required": [
+                  "login"
+                ]
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "OK",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "error": {
+                      "type": "string"
+                    },
+                    "response": {
+                      "$ref": "#/components/schemas/NewUser"
+                    }
+                  },
+                  "required": [
+                    "error"
+                  ]
+                }
+              }
+            }
+          },
+          "400": {
+            "description": "Invalid params, all the failed checks joined with \"; \"",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          },
+          "403": {
+            "description": "Unauthorized",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          },
+          "default": {
+            "description": "Error of the method",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          }
+        }
+      }
+    },
+    "/user/profile": {
+      "get": {
+        "operationId": "Profile",
+        "parameters": [
+          {
+            "name": "login",
+            "in": "query",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "OK",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "error": {
+                      "type": "string"
+                    },
+                    "response": {
+                      "$ref": "#/components/schemas/User"
+                    }
+                  },
+                  "required": [
+                    "error"
+                  ]
+                }
+              }
+            }
+          },
+          "400": {
+            "description": "Invalid params, all the failed checks joined with \"; \"",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          },
+          "default": {
+            "description": "Error of the method",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          }
+        }
+      },
+      "post": {
+        "operationId": "Profile",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "login": {
+                    "type": "string"
+                  }
+                },
+                "required": [
+                  "login"
+                ]
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "OK",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "error": {
+                      "type": "string"
+                    },
+                    "response": {
+                      "$ref": "#/components/schemas/User"
+                    }
+                  },
+                  "required": [
+                    "error"
+                  ]
+                }
+              }
+            }
+          },
+          "400": {
+            "description": "Invalid params, all the failed checks joined with \"; \"",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          },
+          "default": {
+            "description": "Error of the method",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "Error": {
+        "type": "object",
+        "properties": {
+          "error": {
+            "type": "string"
+          }
+        },
+        "required": [
+          "error"
+        ]
+      },
+      "NewUser": {
+        "type": "object",
+        "properties": {
+          "id": {
+            "type": "integer"
+          }
+        },
+        "required": [
+          "id"
+        ]
+      },
+      "User": {
+        "type": "object",
+        "properties": {
+          "full_name": {
+            "type": "string"
+          },
+          "id": {
+            "type": "integer"
+          },
+          "login": {
+            "type": "string"
+          },
+          "status": {
+            "type": "integer"
+          }
+        },
+        "required": [
+          "full_name",
+          "id",
+          "login",
+          "status"
+        ]
+      }
+    },
+    "securitySchemes": {
+      "apiKey": {
+        "type": "apiKey",
+        "in": "header",
+        "name": "X-Auth"
+      }
+    }
+  }
+}`
+
+func (srv *MyApi) wrapperCreate(w http.ResponseWriter, r *http.Request) {
+	if authorized := auth(r); !authorized {
+		httpResponse{Err: errUnauthorized.Error()}.write(w, http.StatusForbidden)
+		return
 	}
-	ageRaw := r.Form.Get("age")
-	// to set default int value without error
-	if ageRaw == "" {
-		ageRaw = "0"
+
+	in, err := getAndValidateCreateParams(r)
+	if err != nil {
+		httpResponse{Err: err.Error()}.write(w, http.StatusBadRequest)
+		return
 	}
-	age, err := strconv.Atoi(ageRaw)
+
+	result, err := srv.Create(r.Context(), in)
 	if err != nil {
-		return CreateParams{}, fmt.Errorf("age must be int")
+		var ae ApiError
+		if errors.As(err, &ae) {
+			httpResponse{Err: ae.Error()}.write(w, ae.HTTPStatus)
+			return
+		}
+		httpResponse{Err: err.Error()}.write(w, http.StatusInternalServerError)
+		return
+	}
+
+	httpResponse{Response: result}.write(w, http.StatusOK)
+}
+
+// getAndValidateCreateParams checks every field and returns all the failed checks at once
+func getAndValidateCreateParams(r *http.Request) (CreateParams, error) {
+	if err := r.ParseForm(); err != nil {
+		return CreateParams{}, err
+	}
+
+	var errs validationError
+	var fieldLogin string
+	if err := func() error {
+		fieldLogin = r.Form.Get("login")
+		if fieldLogin == "" {
+			return fmt.Errorf("login must me not empty")
+		}
+		if len(fieldLogin) < 10 {
+			return fmt.Errorf("login len must be >= 10")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	fieldName := r.Form.Get("full_name")
+	var fieldStatus string
+	if err := func() error {
+		fieldStatus = r.Form.Get("status")
+		if fieldStatus == "" {
+			fieldStatus = "user"
+		}
+		switch fieldStatus {
+		case "user", "moderator", "admin":
+		default:
+			return fmt.Errorf("status must be one of [user, moderator, admin]")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
 	}
-	if age < 0 {
-		return CreateParams{}, fmt.Errorf("age must be >= 0")
+	var fieldAge int
+	if err := func() error {
+		rawAge := r.Form.Get("age")
+		if rawAge != "" {
+			parsed, err := strconv.Atoi(rawAge)
+			if err != nil {
+				return fmt.Errorf("age must be int")
+			}
+			fieldAge = parsed
+		}
+		if fieldAge < 0 {
+			return fmt.Errorf("age must be >= 0")
+		}
+		if fieldAge > 128 {
+			return fmt.Errorf("age must be <= 128")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
 	}
-	if age > 128 {
-		return CreateParams{}, fmt.Errorf("age must be <= 128")
+
+	if len(errs) > 0 {
+		return CreateParams{}, errs
 	}
 
 	in := CreateParams{
-		Login:  login,
-		Name:   name,
-		Status: status,
-		Age:    age,
+		Login:  fieldLogin,
+		Name:   fieldName,
+		Status: fieldStatus,
+		Age:    fieldAge,
 	}
 
 	return in, nil
@@ -145,26 +1644,45 @@ func (srv *MyApi) wrapperProfile(w http.ResponseWriter, r *http.Request) {
 	httpResponse{Response: result}.write(w, http.StatusOK)
 }
 
+// getAndValidateProfileParams checks every field and returns all the failed checks at once
 func getAndValidateProfileParams(r *http.Request) (ProfileParams, error) {
 	if err := r.ParseForm(); err != nil {
 		return ProfileParams{}, err
 	}
 
-	login := r.Form.Get("login")
-	if login == "" {
-		return ProfileParams{}, fmt.Errorf("login must me not empty")
+	var errs validationError
+	var fieldLogin string
+	if err := func() error {
+		fieldLogin = r.Form.Get("login")
+		if fieldLogin == "" {
+			return fmt.Errorf("login must me not empty")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return ProfileParams{}, errs
 	}
 
 	in := ProfileParams{
-		Login: login,
+		Login: fieldLogin,
 	}
 
 	return in, nil
 }
 
 func (srv *OtherApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.URL.Path {
-	case "/user/create":
+	switch {
+	case r.URL.Path == "/openapi.json":
+		if r.Method != http.MethodGet {
+			httpResponse{Err: errStatusNotAcceptable.Error()}.write(w, http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, openapiOtherApi)
+	case r.URL.Path == "/user/create":
 		switch r.Method {
 		case "POST":
 			srv.wrapperCreate(w, r)
@@ -176,6 +1694,161 @@ func (srv *OtherApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// openapiOtherApi is the OpenAPI document of the handlers above
+const openapiOtherApi = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "OtherApi",
+    "version": "1.0.0"
+  },
+  "paths": {
+    "/user/create": {
+      "post": {
+        "operationId": "Create",
+        "security": [
+          {
+            "apiKey": []
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "account_name": {
+                    "type": "string"
+                  },
+                  "class": {
+                    "type": "string",
+                    "enum": [
+                      "warrior",
+                      "sorcerer",
+                      "rouge"
+                    ],
+                    "default": "warrior"
+                  },
+                  "level": {
+                    "type": "integer",
+                    "minimum": 1,
+                    "maximum": 50
+                  },
+                  "username": {
+                    "type": "string",
+                    "minLength": 3
+                  }
+                },
+                "required": [
+                  "username"
+                ]
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "OK",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "error": {
+                      "type": "string"
+                    },
+                    "response": {
+                      "$ref": "#/components/schemas/OtherUser"
+                    }
+                  },
+                  "required": [
+                    "error"
+                  ]
+                }
+              }
+            }
+          },
+          "400": {
+            "description": "Invalid params, all the failed checks joined with \"; \"",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          },
+          "403": {
+            "description": "Unauthorized",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          },
+          "default": {
+            "description": "Error of the method",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Error"
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "Error": {
+        "type": "object",
+        "properties": {
+          "error": {
+            "type": "string"
+          }
+        },
+        "required": [
+          "error"
+        ]
+      },
+      "OtherUser": {
+        "type": "object",
+        "properties": {
+          "full_name": {
+            "type": "string"
+          },
+          "id": {
+            "type": "integer"
+          },
+          "level": {
+            "type": "integer"
+          },
+          "login": {
+            "type": "string"
+          }
+        },
+        "required": [
+          "full_name",
+          "id",
+          "level",
+          "login"
+        ]
+      }
+    },
+    "securitySchemes": {
+      "apiKey": {
+        "type": "apiKey",
+        "in": "header",
+        "name": "X-Auth"
+      }
+    }
+  }
+}`
+
 func (srv *OtherApi) wrapperCreate(w http.ResponseWriter, r *http.Request) {
 	if authorized := auth(r); !authorized {
 		httpResponse{Err: errUnauthorized.Error()}.write(w, http.StatusForbidden)
@@ -202,50 +1875,250 @@ func (srv *OtherApi) wrapperCreate(w http.ResponseWriter, r *http.Request) {
 	httpResponse{Response: result}.write(w, http.StatusOK)
 }
 
+// getAndValidateOtherCreateParams checks every field and returns all the failed checks at once
 func getAndValidateOtherCreateParams(r *http.Request) (OtherCreateParams, error) {
 	if err := r.ParseForm(); err != nil {
 		return OtherCreateParams{}, err
 	}
 
-	username := r.Form.Get("username")
-	if username == "" {
-		return OtherCreateParams{}, fmt.Errorf("username must me not empty")
+	var errs validationError
+	var fieldUsername string
+	if err := func() error {
+		fieldUsername = r.Form.Get("username")
+		if fieldUsername == "" {
+			return fmt.Errorf("username must me not empty")
+		}
+		if len(fieldUsername) < 3 {
+			return fmt.Errorf("username len must be >= 3")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
 	}
-	if len(username) < 3 {
-		return OtherCreateParams{}, fmt.Errorf("username len must be >= 3")
+	fieldName := r.Form.Get("account_name")
+	var fieldClass string
+	if err := func() error {
+		fieldClass = r.Form.Get("class")
+		if fieldClass == "" {
+			fieldClass = "warrior"
+		}
+		switch fieldClass {
+		case "warrior", "sorcerer", "rouge":
+		default:
+			return fmt.Errorf("class must be one of [warrior, sorcerer, rouge]")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
 	}
-	name := r.Form.Get("account_name")
-	class := r.Form.Get("class")
-	if class == "" {
-		class = "warrior"
+	var fieldLevel int
+	if err := func() error {
+		rawLevel := r.Form.Get("level")
+		if rawLevel != "" {
+			parsed, err := strconv.Atoi(rawLevel)
+			if err != nil {
+				return fmt.Errorf("level must be int")
+			}
+			fieldLevel = parsed
+		}
+		if fieldLevel < 1 {
+			return fmt.Errorf("level must be >= 1")
+		}
+		if fieldLevel > 50 {
+			return fmt.Errorf("level must be <= 50")
+		}
+		return nil
+	}(); err != nil {
+		errs = append(errs, err.Error())
 	}
-	switch class {
-	case "warrior", "sorcerer", "rouge":
-	default:
-		return OtherCreateParams{}, fmt.Errorf("class must be one of [warrior, sorcerer, rouge]")
+
+	if len(errs) > 0 {
+		return OtherCreateParams{}, errs
 	}
-	levelRaw := r.Form.Get("level")
-	// to set default int value without error
-	if levelRaw == "" {
-		levelRaw = "0"
+
+	in := OtherCreateParams{
+		Username: fieldUsername,
+		Name:     fieldName,
+		Class:    fieldClass,
+		Level:    fieldLevel,
+	}
+
+	return in, nil
+}
+
+// pathMatcher matches the path against the patterns with {name} and {name...} wildcards and sets the path values
+// of the request, so r.PathValue works as with http.ServeMux. The escaped path is split on the first pattern tried,
+// so an escaped slash stays in its segment
+type pathMatcher struct {
+	r        *http.Request
+	segments []string
+	// err is set if the path matches the pattern but a wildcard value can't be unescaped
+	err error
+}
+
+func (m *pathMatcher) match(pattern string) bool {
+	if m.segments == nil {
+		m.segments = strings.Split(strings.TrimPrefix(m.r.URL.EscapedPath(), "/"), "/")
 	}
-	level, err := strconv.Atoi(levelRaw)
+	segments := m.segments
+	patternSegments := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	values := make(map[string]string, len(patternSegments))
+	for i, patternSegment := range patternSegments {
+		if i >= len(segments) {
+			return false
+		}
+		name, isWildcard := strings.CutPrefix(patternSegment, "{")
+		name, _ = strings.CutSuffix(name, "}")
+		if !isWildcard {
+			if segment, err := url.PathUnescape(segments[i]); err != nil || segment != patternSegment {
+				return false
+			}
+			continue
+		}
+		if rest, ok := strings.CutSuffix(name, "..."); ok {
+			values[rest] = strings.Join(segments[i:], "/")
+			segments = segments[:i+1]
+			break
+		}
+		if segments[i] == "" {
+			return false
+		}
+		values[name] = segments[i]
+	}
+	if len(segments) != len(patternSegments) {
+		return false
+	}
+	for name, value := range values {
+		unescaped, err := url.PathUnescape(value)
+		if err != nil {
+			m.err = fmt.Errorf("bad path value %s", value)
+			return true
+		}
+		values[name] = unescaped
+	}
+	for name, value := range values {
+		m.r.SetPathValue(name, value)
+	}
+	return true
+}
+
+// Authenticator checks the credentials of a request and returns who made it.
+// An ApiError is written as is, any other error is written as 403 unauthorized
+type Authenticator interface {
+	Authenticate(r *http.Request) (principal any, err error)
+}
+
+// AuthenticatorFunc is a func used as an Authenticator
+type AuthenticatorFunc func(r *http.Request) (any, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (any, error) {
+	return f(r)
+}
+
+var (
+	authenticatorsMu sync.RWMutex
+	authenticators   = map[string]Authenticator{}
+)
+
+// RegisterAuthenticator makes the authenticator available to the methods with "auth": name in the annotation
+func RegisterAuthenticator(name string, authenticator Authenticator) {
+	authenticatorsMu.Lock()
+	defer authenticatorsMu.Unlock()
+	authenticators[name] = authenticator
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the principal of the authenticator of the method
+func PrincipalFromContext(ctx context.Context) (any, bool) {
+	principal := ctx.Value(principalKey{})
+	return principal, principal != nil
+}
+
+// authenticate returns the request with the principal in its context
+func authenticate(r *http.Request, name string) (*http.Request, error) {
+	authenticatorsMu.RLock()
+	authenticator, ok := authenticators[name]
+	authenticatorsMu.RUnlock()
+	if !ok {
+		return nil, ApiError{http.StatusInternalServerError, fmt.Errorf("unknown authenticator %s", name)}
+	}
+	principal, err := authenticator.Authenticate(r)
 	if err != nil {
-		return OtherCreateParams{}, fmt.Errorf("level must be int")
+		return nil, err
 	}
-	if level < 1 {
-		return OtherCreateParams{}, fmt.Errorf("level must be >= 1")
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)), nil
+}
+
+// Middleware wraps the handler of a method, e.g. for logging or rate limiting
+type Middleware func(next http.Handler) http.Handler
+
+var (
+	middlewareMu sync.RWMutex
+	middleware   = map[string]Middleware{}
+	// middlewareChains are the chains built for the methods, RegisterMiddleware drops them
+	middlewareChains = map[string]http.Handler{}
+)
+
+// RegisterMiddleware makes the middleware available to the methods with name in "middleware" of the annotation
+func RegisterMiddleware(name string, m Middleware) {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	middleware[name] = m
+	clear(middlewareChains)
+}
+
+type methodHandlerKey struct{}
+
+// callMethodHandler ends every chain, it calls the handler of the method passed in the request context
+var callMethodHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	r.Context().Value(methodHandlerKey{}).(http.Handler).ServeHTTP(w, r)
+})
+
+// serveWithMiddleware serves the request with the chain of the method. The chain is built once
+// and reused by all requests, so the state of a middleware (e.g. a rate limiter) is kept between them
+func serveWithMiddleware(w http.ResponseWriter, r *http.Request, method string, handler http.Handler, names ...string) {
+	ctx := context.WithValue(r.Context(), methodHandlerKey{}, handler)
+	middlewareChain(method, names).ServeHTTP(w, r.WithContext(ctx))
+}
+
+func middlewareChain(method string, names []string) http.Handler {
+	middlewareMu.RLock()
+	chain, ok := middlewareChains[method]
+	middlewareMu.RUnlock()
+	if ok {
+		return chain
 	}
-	if level > 50 {
-		return OtherCreateParams{}, fmt.Errorf("level must be <= 50")
+
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	if chain, ok := middlewareChains[method]; ok {
+		return chain
 	}
+	chain = withMiddleware(callMethodHandler, names...)
+	middlewareChains[method] = chain
+	return chain
+}
 
-	in := OtherCreateParams{
-		Username: username,
-		Name:     name,
-		Class:    class,
-		Level:    level,
+// withMiddleware chains the middlewares, the first one is the outermost. middlewareMu must be held
+func withMiddleware(handler http.Handler, names ...string) http.Handler {
+	for i := len(names) - 1; i >= 0; i-- {
+		m, ok := middleware[names[i]]
+		if !ok {
+			err := fmt.Errorf("unknown middleware %s", names[i])
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				httpResponse{Err: err.Error()}.write(w, http.StatusInternalServerError)
+			})
+		}
+		handler = m(handler)
 	}
+	return handler
+}
 
-	return in, nil
+// isEmail accepts bare addresses only, without a display name
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
 }
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
@@ -0,0 +1,446 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ApiError is an error response of the api
+type ApiError struct {
+	HTTPStatus int
+	Err        error
+}
+
+func (ae ApiError) Error() string {
+	return ae.Err.Error()
+}
+
+func (ae ApiError) Unwrap() error {
+	return ae.Err
+}
+
+// apiResponse is the envelope the generated handlers write
+type apiResponse struct {
+	Err      string          `json:"error"`
+	Response json.RawMessage `json:"response"`
+}
+
+// newRequest sends the form or the body if they are not nil
+func newRequest(ctx context.Context, method string, target string, query url.Values, form url.Values, body map[string]any) (*http.Request, error) {
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var (
+		reader      io.Reader
+		contentType string
+	)
+	switch {
+	case body != nil:
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader, contentType = bytes.NewReader(data), "application/json"
+	case form != nil:
+		reader, contentType = strings.NewReader(form.Encode()), "application/x-www-form-urlencoded"
+	}
+	r, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	return r, nil
+}
+
+// doRequest decodes the response of the envelope into result, the error of the envelope is returned as ApiError
+func doRequest(client *http.Client, r *http.Request, result any) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return ApiError{resp.StatusCode, fmt.Errorf("cant unpack response: %w", err)}
+	}
+	if resp.StatusCode != http.StatusOK || envelope.Err != "" {
+		return ApiError{resp.StatusCode, errors.New(envelope.Err)}
+	}
+	if len(envelope.Response) == 0 {
+		return nil
+	}
+	return json.Unmarshal(envelope.Response, result)
+}
+
+// setPathParam puts the escaped value in place of {name} or {name...}
+func setPathParam(path string, name string, value string) string {
+	value = url.PathEscape(value)
+	return strings.NewReplacer("{"+name+"}", value, "{"+name+"...}", value).Replace(path)
+}
+
+// Ptr returns a pointer to the value, it sets the optional params, which are sent even if they are zero
+func Ptr[T any](value T) *T {
+	return &value
+}
+
+type CreateParams struct {
+	Login  string `apivalidator:"required,min=10"`
+	Name   string `apivalidator:"paramname=full_name"`
+	Status string `apivalidator:"enum=user|moderator|admin,default=user"`
+	Age    int    `apivalidator:"min=0,max=128"`
+}
+
+type DeleteParams struct {
+	ID int `apivalidator:"from=path,paramname=id,min=1"`
+}
+
+type Deleted struct {
+	ID int    `json:"id"`
+	By string `json:"by"`
+}
+
+type Dimensions struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+type FindParams struct {
+	Title string `apivalidator:"from=path,paramname=title,required"`
+}
+
+type Item struct {
+	ID         int        `json:"id"`
+	Available  bool       `json:"available"`
+	Price      float64    `json:"price"`
+	Since      time.Time  `json:"since"`
+	Tags       []string   `json:"tags"`
+	Sizes      []int      `json:"sizes"`
+	Title      string     `json:"title,omitempty"`
+	Dimensions Dimensions `json:"dimensions"`
+	Colors     []string   `json:"colors,omitempty"`
+	Count      int        `json:"count,omitempty"`
+}
+
+type ItemParams struct {
+	ID        int       `apivalidator:"from=path,paramname=id,min=1"`
+	Available *bool     `apivalidator:"default=true"`
+	Price     float64   `apivalidator:"min=0.5,max=1000"`
+	Since     time.Time `apivalidator:"paramname=since"`
+	Tags      []string  `apivalidator:"paramname=tag,min=2"`
+	Sizes     []int     `apivalidator:"from=query,paramname=size,enum=36|38|40"`
+	Token     string    `apivalidator:"from=header,paramname=X-Token,required"`
+}
+
+type NewUser struct {
+	ID uint64 `json:"id"`
+}
+
+type OtherCreateParams struct {
+	Username string `apivalidator:"required,min=3"`
+	Name     string `apivalidator:"paramname=account_name"`
+	Class    string `apivalidator:"enum=warrior|sorcerer|rouge,default=warrior"`
+	Level    int    `apivalidator:"min=1,max=50"`
+}
+
+type OtherUser struct {
+	ID       uint64 `json:"id"`
+	Login    string `json:"login"`
+	FullName string `json:"full_name"`
+	Level    int    `json:"level"`
+}
+
+type ProfileParams struct {
+	Login string `apivalidator:"required"`
+}
+
+type Reservation struct {
+	Email  string `json:"email"`
+	Order  string `json:"order_id"`
+	Guests int    `json:"guests"`
+	Nights int    `json:"nights"`
+	Code   string `json:"promo_code"`
+}
+
+type ReserveParams struct {
+	Email  string    `apivalidator:"required,email"`
+	Order  string    `apivalidator:"paramname=order_id,uuid"`
+	Pin    string    `apivalidator:"required,len=4"`
+	Guests *int      `apivalidator:"default=2,oneof=1 2 4"`
+	From   time.Time `apivalidator:"required"`
+	Till   time.Time `apivalidator:"required,gtfield=From"`
+	Code   string    `apivalidator:"paramname=promo_code,regexp=^[A-Z]{2,4}-[0-9]{1,3}$"`
+}
+
+type StoreParams struct {
+	Title      string     `apivalidator:"from=body,paramname=title,required,min=3"`
+	Dimensions Dimensions `apivalidator:"paramname=dimensions,required"`
+	Colors     []string   `apivalidator:"from=body,paramname=colors,enum=red|green|blue"`
+	Count      *int       `apivalidator:"from=body,paramname=count,default=1,max=10"`
+}
+
+type User struct {
+	ID       uint64 `json:"id"`
+	Login    string `json:"login"`
+	FullName string `json:"full_name"`
+	Status   int    `json:"status"`
+}
+
+// ItemsApiClient calls the handlers generated for ItemsApi
+type ItemsApiClient struct {
+	BaseURL string
+	// HTTPClient is http.DefaultClient if it's nil
+	HTTPClient *http.Client
+	// AuthToken is sent in X-Auth to the methods with "auth": true
+	AuthToken string
+	// Credentials add to the requests the credentials of the authenticators of the methods with "auth": name
+	Credentials map[string]func(r *http.Request)
+}
+
+func NewItemsApiClient(baseURL string) *ItemsApiClient {
+	return &ItemsApiClient{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+func (c *ItemsApiClient) Delete(ctx context.Context, in DeleteParams) (*Deleted, error) {
+	var result *Deleted
+	path := "/items/{id}"
+	query := url.Values{}
+	path = setPathParam(path, "id", strconv.Itoa(in.ID))
+
+	r, err := newRequest(ctx, "DELETE", c.BaseURL+path, query, nil, nil)
+	if err != nil {
+		return result, err
+	}
+	if credentials, ok := c.Credentials["bearer"]; ok {
+		credentials(r)
+	}
+
+	err = doRequest(c.HTTPClient, r, &result)
+	return result, err
+}
+
+func (c *ItemsApiClient) Find(ctx context.Context, in FindParams) (*Item, error) {
+	var result *Item
+	path := "/items/find/{title}"
+	query := url.Values{}
+	path = setPathParam(path, "title", in.Title)
+
+	r, err := newRequest(ctx, "GET", c.BaseURL+path, query, nil, nil)
+	if err != nil {
+		return result, err
+	}
+
+	err = doRequest(c.HTTPClient, r, &result)
+	return result, err
+}
+
+func (c *ItemsApiClient) Item(ctx context.Context, in ItemParams) (*Item, error) {
+	var result *Item
+	path := "/items/{id}"
+	query := url.Values{}
+	path = setPathParam(path, "id", strconv.Itoa(in.ID))
+	if in.Available != nil {
+		query.Set("available", strconv.FormatBool(*in.Available))
+	}
+	if in.Price != 0 {
+		query.Set("price", strconv.FormatFloat(in.Price, 'f', -1, 64))
+	}
+	if !in.Since.IsZero() {
+		query.Set("since", in.Since.Format(time.RFC3339Nano))
+	}
+	for _, item := range in.Tags {
+		query.Add("tag", item)
+	}
+	for _, item := range in.Sizes {
+		query.Add("size", strconv.Itoa(item))
+	}
+
+	r, err := newRequest(ctx, "GET", c.BaseURL+path, query, nil, nil)
+	if err != nil {
+		return result, err
+	}
+	if in.Token != "" {
+		r.Header.Set("X-Token", in.Token)
+	}
+
+	err = doRequest(c.HTTPClient, r, &result)
+	return result, err
+}
+
+func (c *ItemsApiClient) Reserve(ctx context.Context, in ReserveParams) (*Reservation, error) {
+	var result *Reservation
+	path := "/items/reserve"
+	query := url.Values{}
+	form := url.Values{}
+	if in.Email != "" {
+		form.Set("email", in.Email)
+	}
+	if in.Order != "" {
+		form.Set("order_id", in.Order)
+	}
+	if in.Pin != "" {
+		form.Set("pin", in.Pin)
+	}
+	if in.Guests != nil {
+		form.Set("guests", strconv.Itoa(*in.Guests))
+	}
+	if !in.From.IsZero() {
+		form.Set("from", in.From.Format(time.RFC3339Nano))
+	}
+	if !in.Till.IsZero() {
+		form.Set("till", in.Till.Format(time.RFC3339Nano))
+	}
+	if in.Code != "" {
+		form.Set("promo_code", in.Code)
+	}
+
+	r, err := newRequest(ctx, "POST", c.BaseURL+path, query, form, nil)
+	if err != nil {
+		return result, err
+	}
+
+	err = doRequest(c.HTTPClient, r, &result)
+	return result, err
+}
+
+func (c *ItemsApiClient) Store(ctx context.Context, in StoreParams) (*Item, error) {
+	var result *Item
+	path := "/items"
+	query := url.Values{}
+	body := map[string]any{}
+	if in.Title != "" {
+		body["title"] = in.Title
+	}
+	body["dimensions"] = in.Dimensions
+	if len(in.Colors) > 0 {
+		body["colors"] = in.Colors
+	}
+	if in.Count != nil {
+		body["count"] = *in.Count
+	}
+
+	r, err := newRequest(ctx, "POST", c.BaseURL+path, query, nil, body)
+	if err != nil {
+		return result, err
+	}
+
+	err = doRequest(c.HTTPClient, r, &result)
+	return result, err
+}
+
+// MyApiClient calls the handlers generated for MyApi
+type MyApiClient struct {
+	BaseURL string
+	// HTTPClient is http.DefaultClient if it's nil
+	HTTPClient *http.Client
+	// AuthToken is sent in X-Auth to the methods with "auth": true
+	AuthToken string
+	// Credentials add to the requests the credentials of the authenticators of the methods with "auth": name
+	Credentials map[string]func(r *http.Request)
+}
+
+func NewMyApiClient(baseURL string) *MyApiClient {
+	return &MyApiClient{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+func (c *MyApiClient) Create(ctx context.Context, in CreateParams) (*NewUser, error) {
+	var result *NewUser
+	path := "/user/create"
+	query := url.Values{}
+	form := url.Values{}
+	if in.Login != "" {
+		form.Set("login", in.Login)
+	}
+	if in.Name != "" {
+		form.Set("full_name", in.Name)
+	}
+	if in.Status != "" {
+		form.Set("status", in.Status)
+	}
+	if in.Age != 0 {
+		form.Set("age", strconv.Itoa(in.Age))
+	}
+
+	r, err := newRequest(ctx, "POST", c.BaseURL+path, query, form, nil)
+	if err != nil {
+		return result, err
+	}
+	r.Header.Set("X-Auth", c.AuthToken)
+
+	err = doRequest(c.HTTPClient, r, &result)
+	return result, err
+}
+
+func (c *MyApiClient) Profile(ctx context.Context, in ProfileParams) (*User, error) {
+	var result *User
+	path := "/user/profile"
+	query := url.Values{}
+	if in.Login != "" {
+		query.Set("login", in.Login)
+	}
+
+	r, err := newRequest(ctx, "GET", c.BaseURL+path, query, nil, nil)
+	if err != nil {
+		return result, err
+	}
+
+	err = doRequest(c.HTTPClient, r, &result)
+	return result, err
+}
+
+// OtherApiClient calls the handlers generated for OtherApi
+type OtherApiClient struct {
+	BaseURL string
+	// HTTPClient is http.DefaultClient if it's nil
+	HTTPClient *http.Client
+	// AuthToken is sent in X-Auth to the methods with "auth": true
+	AuthToken string
+	// Credentials add to the requests the credentials of the authenticators of the methods with "auth": name
+	Credentials map[string]func(r *http.Request)
+}
+
+func NewOtherApiClient(baseURL string) *OtherApiClient {
+	return &OtherApiClient{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+func (c *OtherApiClient) Create(ctx context.Context, in OtherCreateParams) (*OtherUser, error) {
+	var result *OtherUser
+	path := "/user/create"
+	query := url.Values{}
+	form := url.Values{}
+	if in.Username != "" {
+		form.Set("username", in.Username)
+	}
+	if in.Name != "" {
+		form.Set("account_name", in.Name)
+	}
+	if in.Class != "" {
+		form.Set("class", in.Class)
+	}
+	if in.Level != 0 {
+		form.Set("level", strconv.Itoa(in.Level))
+	}
+
+	r, err := newRequest(ctx, "POST", c.BaseURL+path, query, form, nil)
+	if err != nil {
+		return result, err
+	}
+	r.Header.Set("X-Auth", c.AuthToken)
+
+	err = doRequest(c.HTTPClient, r, &result)
+	return result, err
+}
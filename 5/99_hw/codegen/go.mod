@@ -2,4 +2,10 @@ module codegenhw
 
 go 1.22.0
 
-require github.com/m1ker1n/go-generics v0.1.5 // indirect
+require gopkg.in/yaml.v3 v3.0.1
+
+require (
+	golang.org/x/mod v0.23.0 // indirect
+	golang.org/x/sync v0.11.0 // indirect
+	golang.org/x/tools v0.30.0
+)
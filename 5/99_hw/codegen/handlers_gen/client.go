@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"go/types"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// ClientTemplate is the data of client.tmpl, the client package can't import the package
+// of the api, so the types of params and results are copied into it
+type ClientTemplate struct {
+	Package string
+	// Imports are the packages of the types from other packages than the api one
+	Imports []string
+	// Types are declarations of the copied types sorted by name
+	Types   []string
+	Clients []*ServeHTTPWrapper
+}
+
+func NewClientTemplate(dir string, pkg *Package, serveWrappers map[string]*ServeHTTPWrapper, qualifier *typeQualifier) ClientTemplate {
+	result := ClientTemplate{Package: filepath.Base(dir)}
+
+	for _, serveWrapper := range serveWrappers {
+		result.Clients = append(result.Clients, serveWrapper)
+	}
+	sort.Slice(result.Clients, func(i, j int) bool {
+		return result.Clients[i].RecvTypeName < result.Clients[j].RecvTypeName
+	})
+
+	//the wrappers are walked in order, so the packages with the same name get the same aliases on every run
+	named := make(map[string]*types.Named)
+	optional := make(map[*types.TypeName]map[string]bool)
+	for _, client := range result.Clients {
+		for _, wrapper := range client.ClientMethods() {
+			collectTypes(pkg.Types, wrapper.Params, named)
+			collectOptional(wrapper, optional)
+			collectTypes(pkg.Types, wrapper.Result, named)
+			//the signatures are written with the qualifier as well, so their packages have to be imported
+			qualifier.TypeString(wrapper.Params)
+			qualifier.TypeString(wrapper.Result)
+		}
+	}
+
+	names := make([]string, 0, len(named))
+	for name := range named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result.Types = append(result.Types, typeDecl(qualifier, named[name], optional[named[name].Obj()]))
+	}
+	result.Imports = qualifier.Imports()
+	return result
+}
+
+// writeClient generates client_gen.go of the client package in dir
+func writeClient(dir string, pkg *Package, serveWrappers map[string]*ServeHTTPWrapper) error {
+	//the types of the api package are copied, so they are not qualified, the others are imported
+	qualifier := newTypeQualifier(pkg.Types)
+	tmpl, err := template.New("client.tmpl").Funcs(template.FuncMap{
+		"clientType": qualifier.TypeString,
+	}).Parse(clientTemplate)
+	if err != nil {
+		return err
+	}
+
+	var generated bytes.Buffer
+	if err := tmpl.Execute(&generated, NewClientTemplate(dir, pkg, serveWrappers, qualifier)); err != nil {
+		return err
+	}
+	src, err := formatSource(generated.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "client_gen.go"), src, 0o644)
+}
+
+// collectTypes adds the named types of the api package the type refers to, with the types they refer to
+func collectTypes(local *types.Package, t types.Type, named map[string]*types.Named) {
+	switch t := types.Unalias(t).(type) {
+	case *types.Pointer:
+		collectTypes(local, t.Elem(), named)
+	case *types.Slice:
+		collectTypes(local, t.Elem(), named)
+	case *types.Array:
+		collectTypes(local, t.Elem(), named)
+	case *types.Map:
+		collectTypes(local, t.Key(), named)
+		collectTypes(local, t.Elem(), named)
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			collectTypes(local, t.Field(i).Type(), named)
+		}
+	case *types.Named:
+		if t.Obj().Pkg() != local || named[t.Obj().Name()] != nil {
+			return
+		}
+		named[t.Obj().Name()] = t
+		collectTypes(local, t.Underlying(), named)
+	}
+}
+
+// collectOptional adds the optional fields of the params type of the wrapper
+func collectOptional(wrapper *FuncWrapper, optional map[*types.TypeName]map[string]bool) {
+	params := types.Unalias(wrapper.Params)
+	if pointer, ok := params.(*types.Pointer); ok {
+		params = types.Unalias(pointer.Elem())
+	}
+	named, ok := params.(*types.Named)
+	if !ok {
+		return
+	}
+	for _, field := range wrapper.Input.Fields {
+		if !field.ClientOptional() {
+			continue
+		}
+		if optional[named.Obj()] == nil {
+			optional[named.Obj()] = make(map[string]bool)
+		}
+		optional[named.Obj()][field.Name] = true
+	}
+}
+
+// typeDecl is the declaration of the copied type, the fields of structs are on separate lines as gofmt leaves them,
+// the optional fields are pointers
+func typeDecl(qualifier *typeQualifier, named *types.Named, optional map[string]bool) string {
+	var decl strings.Builder
+	decl.WriteString("type " + named.Obj().Name() + " ")
+	structType, ok := named.Underlying().(*types.Struct)
+	if !ok {
+		decl.WriteString(qualifier.TypeString(named.Underlying()))
+		return decl.String()
+	}
+
+	decl.WriteString("struct {\n")
+	for i := 0; i < structType.NumFields(); i++ {
+		field := structType.Field(i)
+		if !field.Embedded() {
+			decl.WriteString(field.Name() + " ")
+		}
+		if optional[field.Name()] {
+			decl.WriteString("*")
+		}
+		decl.WriteString(qualifier.TypeString(field.Type()))
+		if tag := structType.Tag(i); tag != "" {
+			decl.WriteString(" " + tagLiteral(tag))
+		}
+		decl.WriteString("\n")
+	}
+	decl.WriteString("}")
+	return decl.String()
+}
+
+// tagLiteral is the tag as a raw string literal, if it can be one
+func tagLiteral(tag string) string {
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
+
+// ClientName is the name of the client type of the api struct
+func (s *ServeHTTPWrapper) ClientName() string {
+	return s.RecvTypeName + "Client"
+}
+
+// ClientMethods are the wrappers sorted by the name of the method
+func (s *ServeHTTPWrapper) ClientMethods() []*FuncWrapper {
+	var wrappers []*FuncWrapper
+	for _, methods := range s.Wrappers {
+		for _, wrapper := range methods {
+			wrappers = append(wrappers, wrapper)
+		}
+	}
+	sort.Slice(wrappers, func(i, j int) bool {
+		return wrappers[i].FuncName < wrappers[j].FuncName
+	})
+	return wrappers
+}
+
+// ClientMethod is the method the client sends, handlers of any method get GET or POST if they have a json body
+func (f *FuncWrapper) ClientMethod() string {
+	if f.Options.Method != "" {
+		return f.Options.Method
+	}
+	if f.Input.HasBody() {
+		return http.MethodPost
+	}
+	return http.MethodGet
+}
+
+// FormInBody reports whether the form fields are sent as an urlencoded body,
+// http.Request.ParseForm reads it only for these methods and only if it's not json
+func (f *FuncWrapper) FormInBody() bool {
+	switch f.ClientMethod() {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return !f.Input.HasBody()
+	}
+	return false
+}
+
+// ClientOptional reports whether the field is a pointer in the client params: the handler puts the default
+// in place of a missing param, so the zero value has to be told apart from it. Empty strings and slices
+// out of the body are the same as missing params for the handler anyway
+func (f FuncInputStructField) ClientOptional() bool {
+	if !f.UsesDefault() || f.IsSlice || f.From == FromPath {
+		return false
+	}
+	return f.Kind != KindString || f.From == FromBody
+}
+
+// ClientValue is the value of the field, the optional ones are dereferenced
+func (f FuncInputStructField) ClientValue(value string) string {
+	if f.ClientOptional() {
+		return "*" + value
+	}
+	return value
+}
+
+// ClientSetExpr is the condition of the field being sent, zero values are the same as missing params
+// for the handlers, so they are not sent, unless the field is optional and set; it's empty for the values
+// which are always sent: json values and repeated params, which have no values if the slice is empty
+func (f FuncInputStructField) ClientSetExpr(value string) string {
+	if f.ClientOptional() {
+		return value + " != nil"
+	}
+	if f.IsSlice && f.From != FromBody {
+		return ""
+	}
+	if f.IsSlice || (f.Kind == KindJSON && strings.HasPrefix(f.GoType, "[]")) {
+		return "len(" + value + ") > 0"
+	}
+	switch f.Kind {
+	case KindString:
+		return value + ` != ""`
+	case KindInt, KindFloat:
+		return value + " != 0"
+	case KindBool:
+		return value
+	case KindTime:
+		return "!" + value + ".IsZero()"
+	}
+	return ""
+}
+
+// ClientFormatExpr formats a value of the field kind the way the handler parses it
+func (f FuncInputStructField) ClientFormatExpr(value string) string {
+	switch f.Kind {
+	case KindInt:
+		return "strconv.Itoa(" + value + ")"
+	case KindBool:
+		return "strconv.FormatBool(" + value + ")"
+	case KindFloat:
+		return "strconv.FormatFloat(" + value + ", 'f', -1, 64)"
+	case KindTime:
+		return value + ".Format(time.RFC3339Nano)"
+	}
+	return value
+}
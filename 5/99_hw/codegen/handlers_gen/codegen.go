@@ -1,34 +1,154 @@
 package main
 
 import (
+	"bytes"
+	_ "embed"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
-	"github.com/m1ker1n/go-generics"
 	"go/ast"
-	"go/parser"
 	"go/token"
+	"go/types"
 	"io"
 	"log"
-	"net/http"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
+
+	"gopkg.in/yaml.v3"
 )
 
 const CodegenLabelPrefix = `// apigen:api `
 const FuncWrapperPrefix = `wrapper`
-const ApiValidatorTagPrefix = `apivalidator:"`
+const ApiValidatorTag = `apivalidator`
+
+// the templates are embedded, so the generator runs from any directory, e.g. by go generate
+var (
+	//go:embed template.tmpl
+	handlersTemplate string
+	//go:embed client.tmpl
+	clientTemplate string
+)
 
 type Template struct {
-	Package       string
+	Package string
+	// Imports are the packages of the param and result types from other packages
+	Imports       []string
 	ServeWrappers map[string]*ServeHTTPWrapper
 }
 
+// HasPatterns reports whether any url has path wildcards, so the pathMatcher helper is needed
+func (t Template) HasPatterns() bool {
+	for _, serveWrapper := range t.ServeWrappers {
+		for url := range serveWrapper.Wrappers {
+			if isPattern(url) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasAuthenticators reports whether the registry of authenticators is needed
+func (t Template) HasAuthenticators() bool {
+	return t.anyWrapper(func(f *FuncWrapper) bool { return f.Options.Auth.Authenticator != "" })
+}
+
+// HasMiddleware reports whether the registry of middlewares is needed
+func (t Template) HasMiddleware() bool {
+	return t.anyWrapper(func(f *FuncWrapper) bool { return len(f.Options.Middleware) > 0 })
+}
+
+// HasEmails reports whether the isEmail helper is needed
+func (t Template) HasEmails() bool {
+	return t.anyField(func(f FuncInputStructField) bool { return f.IsEmail })
+}
+
+// HasUUIDs reports whether the uuid regexp is needed
+func (t Template) HasUUIDs() bool {
+	return t.anyField(func(f FuncInputStructField) bool { return f.IsUUID })
+}
+
+func (t Template) anyField(predicate func(FuncInputStructField) bool) bool {
+	return t.anyWrapper(func(f *FuncWrapper) bool {
+		return len(filter(f.Input.Fields, predicate)) > 0
+	})
+}
+
+func (t Template) anyWrapper(predicate func(*FuncWrapper) bool) bool {
+	for _, serveWrapper := range t.ServeWrappers {
+		for _, methods := range serveWrapper.Wrappers {
+			for _, wrapper := range methods {
+				if predicate(wrapper) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 type CodegenOptions struct {
-	Url    string `json:"url"`
-	Auth   bool   `json:"auth"`
-	Method string `json:"method"`
+	Url    string     `json:"url"`
+	Auth   AuthOption `json:"auth"`
+	Method string     `json:"method"`
+	// Middleware are names of the registered middlewares, the first one is the outermost
+	Middleware []string `json:"middleware"`
+	// AuthScheme and AuthHeader describe the credentials of the authenticator in the OpenAPI document:
+	// an http scheme such as bearer or basic, or else an api key in the header, Authorization by default
+	AuthScheme string `json:"auth_scheme"`
+	AuthHeader string `json:"auth_header"`
+}
+
+// httpAuthSchemes are the schemes of the IANA registry OpenAPI allows for the http security scheme
+var httpAuthSchemes = []string{"basic", "bearer", "concealed", "digest", "dpop", "gnap", "hoba", "mutual",
+	"negotiate", "oauth", "privatetoken", "scram-sha-1", "scram-sha-256", "vapid"}
+
+func (o CodegenOptions) validate() error {
+	if (o.AuthScheme != "" || o.AuthHeader != "") && o.Auth.Authenticator == "" {
+		return errors.New("auth_scheme and auth_header need an authenticator name in auth")
+	}
+	if o.AuthScheme != "" && o.AuthHeader != "" {
+		return errors.New("auth_scheme and auth_header can't be set together")
+	}
+	if o.AuthScheme != "" && !slices.Contains(httpAuthSchemes, strings.ToLower(o.AuthScheme)) {
+		return fmt.Errorf("auth_scheme must be one of %s, got %q", strings.Join(httpAuthSchemes, ", "), o.AuthScheme)
+	}
+	return nil
+}
+
+// AuthOption is either a bool turning on the X-Auth check
+// or the name of an authenticator registered in the generated code
+type AuthOption struct {
+	Required      bool
+	Authenticator string
+}
+
+func (a *AuthOption) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.Required); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &a.Authenticator); err != nil || a.Authenticator == "" {
+		return fmt.Errorf("auth must be a bool or an authenticator name, got %s", data)
+	}
+	a.Required = true
+	return nil
+}
+
+// MiddlewareList is the middleware names as go string literals separated by commas
+func (o CodegenOptions) MiddlewareList() string {
+	quoted := make([]string, 0, len(o.Middleware))
+	for _, name := range o.Middleware {
+		quoted = append(quoted, strconv.Quote(name))
+	}
+	return strings.Join(quoted, ", ")
 }
 
 type FuncWrapper struct {
@@ -40,11 +160,14 @@ type FuncWrapper struct {
 	FuncName       string
 
 	Input FuncInput
+	// Params and Result are the types of the second param and of the first result of the method
+	Params types.Type
+	Result types.Type
 
 	Options CodegenOptions
 }
 
-func NewFuncWrapper(f *ast.FuncDecl) (*FuncWrapper, error) {
+func NewFuncWrapper(pkg *Package, f *ast.FuncDecl) (*FuncWrapper, error) {
 	var (
 		recvTypeName   string
 		isStarReceiver bool
@@ -55,7 +178,7 @@ func NewFuncWrapper(f *ast.FuncDecl) (*FuncWrapper, error) {
 		isStarReceiver = true
 		i, ok := (expr.X).(*ast.Ident)
 		if !ok {
-			return nil, fmt.Errorf("could not get receiver type name of %s", f.Name.Name)
+			return nil, &PosError{Pos: f.Recv.Pos(), Err: fmt.Errorf("could not get receiver type name of %s", f.Name.Name)}
 		}
 		recvTypeName = i.Name
 	case *ast.Ident:
@@ -63,24 +186,38 @@ func NewFuncWrapper(f *ast.FuncDecl) (*FuncWrapper, error) {
 	}
 
 	var options CodegenOptions
-	codegenOptionLine := generics.Filter(f.Doc.List, func(comment *ast.Comment) bool {
+	codegenOptionLine := filter(f.Doc.List, func(comment *ast.Comment) bool {
 		return strings.Contains(comment.Text, CodegenLabelPrefix)
 	})[0]
 	codegenOptionsJson, ok := strings.CutPrefix(codegenOptionLine.Text, CodegenLabelPrefix)
 	if !ok {
-		return nil, errors.New("codegen options are not provided")
+		return nil, &PosError{Pos: codegenOptionLine.Pos(), Err: errors.New("codegen options are not provided")}
 	}
 	err := json.Unmarshal([]byte(codegenOptionsJson), &options)
 	if err != nil {
-		return nil, fmt.Errorf("could not unpack codegen options: %w", err)
+		return nil, &PosError{Pos: codegenOptionLine.Pos(), Err: fmt.Errorf("could not unpack codegen options: %w", err)}
 	}
-	if options.Method == "" {
-		options.Method = http.MethodGet
+	if err := options.validate(); err != nil {
+		return nil, &PosError{Pos: codegenOptionLine.Pos(), Err: fmt.Errorf("%s: %w", f.Name.Name, err)}
 	}
+	//empty method means that the handler accepts any method
 
-	input, err := FuncDeclToFuncInput(f)
+	signature, err := funcSignature(pkg, f)
 	if err != nil {
-		return nil, fmt.Errorf("could not parse input of function")
+		return nil, err
+	}
+	input, err := FuncDeclToFuncInput(pkg, f)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse input of %s: %w", f.Name.Name, err)
+	}
+	for _, field := range input.Fields {
+		if field.From != FromPath {
+			continue
+		}
+		param := field.ParamName()
+		if !strings.Contains(options.Url, "{"+param+"}") && !strings.Contains(options.Url, "{"+param+"...}") {
+			return nil, &PosError{Pos: codegenOptionLine.Pos(), Err: fmt.Errorf("%s: path param %s is not in url %s", f.Name.Name, param, options.Url)}
+		}
 	}
 
 	return &FuncWrapper{
@@ -90,26 +227,108 @@ func NewFuncWrapper(f *ast.FuncDecl) (*FuncWrapper, error) {
 		RecvTypeName:   recvTypeName,
 		FuncName:       f.Name.Name,
 		Input:          input,
+		Params:         signature.Params().At(1).Type(),
+		Result:         signature.Results().At(0).Type(),
 		Options:        options,
 	}, nil
 }
 
+// funcSignature checks that the method is func(context.Context, Params) (Result, error)
+func funcSignature(pkg *Package, f *ast.FuncDecl) (*types.Signature, error) {
+	fn, ok := pkg.Info.Defs[f.Name].(*types.Func)
+	if !ok {
+		return nil, &PosError{Pos: f.Pos(), Err: fmt.Errorf("%s is not type checked", f.Name.Name)}
+	}
+	signature := fn.Type().(*types.Signature)
+	if err := pkg.checkType(signature); err != nil {
+		return nil, &PosError{Pos: f.Type.Pos(), Err: fmt.Errorf("%s: %w", f.Name.Name, err)}
+	}
+	params, results := signature.Params(), signature.Results()
+	if params.Len() != 2 || !isNamed(params.At(0).Type(), "context", "Context") ||
+		results.Len() != 2 || !isNamed(results.At(1).Type(), "", "error") {
+		return nil, &PosError{Pos: f.Type.Pos(), Err: fmt.Errorf("%s must be func(context.Context, Params) (Result, error)", f.Name.Name)}
+	}
+	return signature, nil
+}
+
+// isNamed reports whether t is the named type of the package with the path, the universe has an empty path
+func isNamed(t types.Type, pkgPath string, name string) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok || named.Obj().Name() != name {
+		return false
+	}
+	if named.Obj().Pkg() == nil {
+		return pkgPath == ""
+	}
+	return named.Obj().Pkg().Path() == pkgPath
+}
+
 func (f *FuncWrapper) WrapperFuncName() string {
 	return FuncWrapperPrefix + f.FuncName
 }
 
+// HandlerFuncName is the method the middlewares of the wrapper are chained to
+func (f *FuncWrapper) HandlerFuncName() string {
+	return f.WrapperFuncName() + "Handler"
+}
+
 type FuncInput struct {
+	// RecvTypeName is the name of the params type, it's a part of the generated function names
 	RecvTypeName string
-	Fields       []FuncInputStructField
+	// TypeName is the params type as it's written in the generated code, with the package if it's from another one
+	TypeName string
+	Fields   []FuncInputStructField
+	// Comparisons are the gtfield and ltfield rules, they are checked after all the fields are valid
+	Comparisons []FieldComparison
+}
+
+// HasBody reports whether any field is decoded from the json body
+func (in FuncInput) HasBody() bool {
+	for _, field := range in.Fields {
+		if field.From == FromBody {
+			return true
+		}
+	}
+	return false
 }
 
+// FieldKind is the type of a field or of the elements of a slice field
+type FieldKind string
+
+const (
+	KindString FieldKind = "string"
+	KindInt    FieldKind = "int"
+	KindBool   FieldKind = "bool"
+	KindFloat  FieldKind = "float64"
+	KindTime   FieldKind = "time.Time"
+	// KindJSON is any other type, it can only be decoded from the json body
+	KindJSON FieldKind = "json"
+)
+
+// Param sources of the from= label, the form (query and urlencoded body) is used if it's not set
+const (
+	FromForm   = ""
+	FromPath   = "path"
+	FromQuery  = "query"
+	FromBody   = "body"
+	FromHeader = "header"
+)
+
 type FuncInputStructField struct {
 	RecvTypeName string
 
-	Name                   string
-	IsInt                  bool
+	Name string
+	// GoType is the type as it's written in the struct
+	GoType string
+	// Type is the checked type, it's used to describe the json body fields in the OpenAPI document
+	Type types.Type
+	// Kind is the type of the field or of its elements if IsSlice
+	Kind                   FieldKind
+	IsSlice                bool
 	ApiValidatorTagContent string
 
+	From string
+
 	IsRequired bool
 
 	HasParamname bool
@@ -126,30 +345,181 @@ type FuncInputStructField struct {
 
 	HasMax bool
 	Max    string
+
+	HasLen bool
+	Len    string
+
+	HasRegexp bool
+	Regexp    string
+
+	IsEmail bool
+	IsUUID  bool
+
+	// GtField and LtField are names of the fields of the same struct the value is compared with
+	GtField string
+	LtField string
 }
 
+// VarName is the local variable of the field in the generated code, the prefix keeps it apart
+// from the other locals and the imported packages, e.g. a field Time from the package time
 func (f FuncInputStructField) VarName() string {
+	return "field" + f.Name
+}
+
+// RawVar is the local variable with the raw string values of the field
+func (f FuncInputStructField) RawVar() string {
+	return "raw" + f.Name
+}
+
+// IsInt is kept for the templates written before the other kinds
+func (f FuncInputStructField) IsInt() bool {
+	return f.Kind == KindInt && !f.IsSlice
+}
+
+func (f FuncInputStructField) ParamName() string {
+	if f.HasParamname {
+		return f.Paramname
+	}
 	return strings.ToLower(f.Name)
 }
 
+// CheckVar is the variable validated by enum, min and max, the rules apply to every element of a slice
+func (f FuncInputStructField) CheckVar() string {
+	if f.IsSlice {
+		return f.VarName() + "Item"
+	}
+	return f.VarName()
+}
+
+// IsLen reports whether min and max are checked against the length
+func (f FuncInputStructField) IsLen() bool {
+	return f.Kind == KindString
+}
+
+// HasChecks reports whether there are rules checked after the value is got
+func (f FuncInputStructField) HasChecks() bool {
+	return f.HasEnums || f.HasLen || f.HasMin || f.HasMax || f.HasRegexp || f.IsEmail || f.IsUUID
+}
+
+// IsPlain reports whether the field is got by a single assignment that can't fail
+func (f FuncInputStructField) IsPlain() bool {
+	return f.Kind == KindString && f.From != FromBody && !f.IsRequired && !f.HasDefault && !f.HasChecks()
+}
+
+// UsesDefault reports whether a missing value is replaced with the default, a required value can't be missing
+func (f FuncInputStructField) UsesDefault() bool {
+	return f.HasDefault && !f.IsRequired
+}
+
+// MayBeEmpty reports whether the checked string may be empty: a required param or a param with a default
+// can't be, but a json string or an element of a slice can
+func (f FuncInputStructField) MayBeEmpty() bool {
+	if f.IsSlice || f.From == FromBody {
+		return true
+	}
+	return !f.IsRequired && (!f.UsesDefault() || f.Default == "")
+}
+
+// RegexpVar is the package variable with the compiled regexp of the field
+func (f FuncInputStructField) RegexpVar() string {
+	return strings.ToLower(f.RecvTypeName[:1]) + f.RecvTypeName[1:] + f.Name + "Regexp"
+}
+
 func (f FuncInputStructField) EnumList() string {
-	return strings.Join(f.Enums, `","`)
+	if f.Kind == KindString {
+		return `"` + strings.Join(f.Enums, `", "`) + `"`
+	}
+	return strings.Join(f.Enums, ", ")
 }
 
 func (f FuncInputStructField) EnumListToError() string {
 	return fmt.Sprintf("[%s]", strings.Join(f.Enums, ", "))
 }
 
-func NewFuncInputStructField(recvTypeName string, name string, isInt bool, tagContent string) (FuncInputStructField, error) {
+// DefaultLiteral is the default as a go literal of the field type, a slice gets it as the only element
+func (f FuncInputStructField) DefaultLiteral() string {
+	literal := f.Default
+	if f.Kind == KindString {
+		literal = strconv.Quote(f.Default)
+	}
+	if f.IsSlice {
+		return f.GoType + "{" + literal + "}"
+	}
+	return literal
+}
+
+// TypeError is the end of the error about a value that can't be parsed
+func (f FuncInputStructField) TypeError() string {
+	kind := string(f.Kind)
+	switch f.Kind {
+	case KindTime:
+		kind = "time in RFC3339 format"
+	case KindJSON:
+		kind = f.GoType
+	}
+	if f.IsSlice && f.Kind != KindJSON {
+		return "list of " + kind
+	}
+	return kind
+}
+
+// ValueExpr returns the expression with the raw string value of a non-body field
+func (f FuncInputStructField) ValueExpr() string {
+	param := strconv.Quote(f.ParamName())
+	switch f.From {
+	case FromPath:
+		return "r.PathValue(" + param + ")"
+	case FromQuery:
+		return "r.URL.Query().Get(" + param + ")"
+	case FromHeader:
+		return "r.Header.Get(" + param + ")"
+	}
+	return "r.Form.Get(" + param + ")"
+}
+
+// ValuesExpr returns the expression with all the raw string values of a non-body slice field
+func (f FuncInputStructField) ValuesExpr() string {
+	param := strconv.Quote(f.ParamName())
+	switch f.From {
+	case FromQuery:
+		return "r.URL.Query()[" + param + "]"
+	case FromHeader:
+		return "r.Header.Values(" + param + ")"
+	}
+	return "r.Form[" + param + "]"
+}
+
+// ParseExpr returns the expression parsing raw into the field kind, it returns a value and an error
+func (f FuncInputStructField) ParseExpr(raw string) string {
+	switch f.Kind {
+	case KindInt:
+		return "strconv.Atoi(" + raw + ")"
+	case KindBool:
+		return "strconv.ParseBool(" + raw + ")"
+	case KindFloat:
+		return "strconv.ParseFloat(" + raw + ", 64)"
+	case KindTime:
+		return "time.Parse(time.RFC3339, " + raw + ")"
+	}
+	return ""
+}
+
+func NewFuncInputStructField(recvTypeName string, name string, goType string, tagContent string) (FuncInputStructField, error) {
 	result := FuncInputStructField{
 		RecvTypeName:           recvTypeName,
 		Name:                   name,
-		IsInt:                  isInt,
+		GoType:                 goType,
 		ApiValidatorTagContent: tagContent,
 	}
+	elemType, isSlice := strings.CutPrefix(goType, "[]")
+	result.Kind = kindOf(elemType)
+	result.IsSlice = isSlice && result.Kind != KindJSON
+	if result.Kind == KindJSON {
+		result.From = FromBody
+	}
 
 	validations := strings.Split(tagContent, ",")
-	for _, validation := range validations {
+	for i, validation := range validations {
 		if validation == "required" {
 			result.IsRequired = true
 			continue
@@ -185,18 +555,265 @@ func NewFuncInputStructField(recvTypeName string, name string, isInt bool, tagCo
 			continue
 		}
 
-		return FuncInputStructField{}, errors.New("undefined label for apivalidator tag")
+		if from, ok := strings.CutPrefix(validation, "from="); ok {
+			result.From = from
+			continue
+		}
+
+		//oneof is enum with the values separated by spaces, as in go-playground/validator
+		if oneof, ok := strings.CutPrefix(validation, "oneof="); ok {
+			result.HasEnums = true
+			result.Enums = strings.Fields(oneof)
+			continue
+		}
+
+		if length, ok := strings.CutPrefix(validation, "len="); ok {
+			result.HasLen = true
+			result.Len = length
+			continue
+		}
+
+		if validation == "email" {
+			result.IsEmail = true
+			continue
+		}
+
+		if validation == "uuid" {
+			result.IsUUID = true
+			continue
+		}
+
+		if gtfield, ok := strings.CutPrefix(validation, "gtfield="); ok {
+			result.GtField = gtfield
+			continue
+		}
+
+		if ltfield, ok := strings.CutPrefix(validation, "ltfield="); ok {
+			result.LtField = ltfield
+			continue
+		}
+
+		//a regexp may have commas, so it takes the rest of the tag and has to be the last label
+		if _, ok := strings.CutPrefix(validation, "regexp="); ok {
+			result.HasRegexp = true
+			result.Regexp = strings.TrimPrefix(strings.Join(validations[i:], ","), "regexp=")
+			break
+		}
+
+		return FuncInputStructField{}, fmt.Errorf("field %s: unknown apivalidator label %q", name, validation)
+	}
+	if err := result.check(); err != nil {
+		return FuncInputStructField{}, fmt.Errorf("field %s: %w", name, err)
 	}
 	return result, nil
 }
 
+func kindOf(goType string) FieldKind {
+	switch kind := FieldKind(goType); kind {
+	case KindString, KindInt, KindBool, KindFloat, KindTime:
+		return kind
+	}
+	return KindJSON
+}
+
+// check rejects the labels that make no sense for the field kind and source
+func (f FuncInputStructField) check() error {
+	switch f.From {
+	case FromForm, FromQuery, FromHeader, FromBody:
+	case FromPath:
+		if f.IsSlice {
+			return errors.New("slices can't be path params")
+		}
+	default:
+		return fmt.Errorf("unknown param source %q", f.From)
+	}
+	if f.Kind == KindJSON && f.From != FromBody {
+		return fmt.Errorf("%s can only be decoded from the body", f.GoType)
+	}
+
+	numeric := f.Kind == KindInt || f.Kind == KindFloat
+	if f.HasEnums && f.Kind != KindString && !numeric {
+		return fmt.Errorf("enum is not supported for %s", f.GoType)
+	}
+	if (f.HasMin || f.HasMax) && f.Kind != KindString && !numeric {
+		return fmt.Errorf("min and max are not supported for %s", f.GoType)
+	}
+	if f.HasDefault && (f.Kind == KindJSON || f.Kind == KindTime) {
+		return fmt.Errorf("default is not supported for %s", f.GoType)
+	}
+	if (f.HasLen || f.HasRegexp || f.IsEmail || f.IsUUID) && f.Kind != KindString {
+		return fmt.Errorf("len, regexp, email and uuid are not supported for %s", f.GoType)
+	}
+	if (f.GtField != "" || f.LtField != "") && (f.IsSlice || f.Kind == KindBool || f.Kind == KindJSON) {
+		return fmt.Errorf("gtfield and ltfield are not supported for %s", f.GoType)
+	}
+	if f.HasRegexp {
+		if _, err := regexp.Compile(f.Regexp); err != nil {
+			return fmt.Errorf("bad regexp: %w", err)
+		}
+	}
+
+	//the values end up in the generated code as literals, so they have to be valid ones
+	boundKind := f.Kind
+	if f.IsLen() {
+		boundKind = KindInt
+	}
+	for _, bound := range []string{f.Min, f.Max} {
+		if err := checkLiteral(boundKind, bound); err != nil {
+			return err
+		}
+	}
+	if err := checkLiteral(KindInt, f.Len); err != nil {
+		return err
+	}
+	if f.Kind != KindString {
+		for _, literal := range append([]string{f.Default}, f.Enums...) {
+			if err := checkLiteral(f.Kind, literal); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FieldComparison is a gtfield or ltfield rule, Field has to be greater or less than Other
+type FieldComparison struct {
+	Field   FuncInputStructField
+	Other   FuncInputStructField
+	Greater bool
+}
+
+func newFieldComparison(fields []FuncInputStructField, field FuncInputStructField, otherName string, greater bool) (FieldComparison, error) {
+	others := filter(fields, func(other FuncInputStructField) bool {
+		return other.Name == otherName
+	})
+	if len(others) == 0 || otherName == field.Name {
+		return FieldComparison{}, fmt.Errorf("field %s: no field %s to compare with", field.Name, otherName)
+	}
+	if others[0].GoType != field.GoType {
+		return FieldComparison{}, fmt.Errorf("field %s: can't compare %s with %s of %s", field.Name, field.GoType, otherName, others[0].GoType)
+	}
+	return FieldComparison{Field: field, Other: others[0], Greater: greater}, nil
+}
+
+// Cond is the condition the valid values satisfy
+func (c FieldComparison) Cond() string {
+	value, other := c.Field.VarName(), c.Other.VarName()
+	if c.Field.Kind == KindTime {
+		if c.Greater {
+			return value + ".After(" + other + ")"
+		}
+		return value + ".Before(" + other + ")"
+	}
+	if c.Greater {
+		return value + " > " + other
+	}
+	return value + " < " + other
+}
+
+func (c FieldComparison) Message() string {
+	relation := "less than"
+	if c.Greater {
+		relation = "greater than"
+	}
+	return c.Field.ParamName() + " must be " + relation + " " + c.Other.ParamName()
+}
+
+// checkLiteral accepts empty literals, they mean that the label is not set
+func checkLiteral(kind FieldKind, literal string) error {
+	if literal == "" {
+		return nil
+	}
+	var err error
+	switch kind {
+	case KindInt:
+		_, err = strconv.Atoi(literal)
+	case KindFloat:
+		_, err = strconv.ParseFloat(literal, 64)
+	case KindBool:
+		_, err = strconv.ParseBool(literal)
+	}
+	if err != nil {
+		return fmt.Errorf("bad value %q for %s", literal, kind)
+	}
+	return nil
+}
+
 // ServeHTTPWrapper always will create function with star receiver
 type ServeHTTPWrapper struct {
 	RecvName     string
 	RecvTypeName string
 
-	//Wrappers[URL][Method] to access some function
+	//Wrappers[URL][Method] to access some function, empty Method accepts any method
 	Wrappers map[string]map[string]*FuncWrapper
+
+	// Spec is the OpenAPI document in json, ServeHTTP serves it at SpecPath
+	Spec []byte
+}
+
+// HasPatterns reports whether any url of the struct has path wildcards, so ServeHTTP matches them
+func (s *ServeHTTPWrapper) HasPatterns() bool {
+	for url := range s.Wrappers {
+		if isPattern(url) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ServeHTTPWrapper) SpecPath() string {
+	return OpenAPIPath
+}
+
+// SpecLiteral is the document as a go string literal
+func (s *ServeHTTPWrapper) SpecLiteral() string {
+	if bytes.ContainsRune(s.Spec, '`') {
+		return strconv.Quote(string(s.Spec))
+	}
+	return "`" + string(s.Spec) + "`"
+}
+
+type Route struct {
+	Url string
+	// Methods are the handlers of specific methods sorted by method
+	Methods []*FuncWrapper
+	// AnyMethod handles the methods that are not in Methods, if it's nil they are not acceptable
+	AnyMethod *FuncWrapper
+}
+
+// IsPattern reports whether the url has {name} or {name...} wildcards
+func (r Route) IsPattern() bool {
+	return isPattern(r.Url)
+}
+
+func isPattern(url string) bool {
+	return strings.Contains(url, "{")
+}
+
+// Routes are sorted so the generated code is stable, plain urls go before patterns to win over them
+func (s *ServeHTTPWrapper) Routes() []Route {
+	routes := make([]Route, 0, len(s.Wrappers))
+	for url, methods := range s.Wrappers {
+		route := Route{Url: url}
+		for method, wrapper := range methods {
+			if method == "" {
+				route.AnyMethod = wrapper
+				continue
+			}
+			route.Methods = append(route.Methods, wrapper)
+		}
+		sort.Slice(route.Methods, func(i, j int) bool {
+			return route.Methods[i].Options.Method < route.Methods[j].Options.Method
+		})
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].IsPattern() != routes[j].IsPattern() {
+			return !routes[i].IsPattern()
+		}
+		return routes[i].Url < routes[j].Url
+	})
+	return routes
 }
 
 var (
@@ -304,25 +921,61 @@ func (r httpResponse) write(w http.ResponseWriter, status int) {
 )
 
 func main() {
-	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, os.Args[1], nil, parser.ParseComments)
-	if err != nil {
-		log.Fatal(err)
+	openapiFormat := flag.String("openapi", "json", "format of the OpenAPI documents written next to the output: json or yaml")
+	clientDir := flag.String("client", "", "directory of the client package, it's not generated if empty")
+	output := flag.String("o", "api_gen.go", "file the handlers are generated to")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: handlers_gen [-openapi json|yaml] [-client dir] [-o api_gen.go] [package]")
+		fmt.Fprintln(flag.CommandLine.Output(), "       handlers_gen [-openapi json|yaml] [-client dir] api.go api_gen.go")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 2 || (*openapiFormat != "json" && *openapiFormat != "yaml") {
+		flag.Usage()
+		os.Exit(2)
+	}
+	//the package is "." by default, the old form with 2 files loads the package of the first one
+	pattern, out := ".", *output
+	switch flag.NArg() {
+	case 1:
+		pattern = flag.Arg(0)
+	case 2:
+		pattern, out = "./"+filepath.ToSlash(filepath.Dir(flag.Arg(0))), flag.Arg(1)
 	}
 
-	out, err := os.Create(os.Args[2])
+	pkg, err := LoadPackage(pattern, out)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	funcDecls := generics.Map(node.Decls, DeclToFuncDecl)
-	funcWrappers, err := generics.TryMap(funcDecls, NewFuncWrapper)
-	if err != nil {
-		log.Fatal(err)
+	var funcWrappers []*FuncWrapper
+	for _, file := range pkg.Files {
+		funcDecls := filterMap(file.Decls, DeclToFuncDecl)
+		wrappers, err := tryMap(funcDecls, func(f *ast.FuncDecl) (*FuncWrapper, error) {
+			return NewFuncWrapper(pkg, f)
+		})
+		var posErr *PosError
+		if errors.As(err, &posErr) {
+			log.Fatalf("%s: %s", pkg.Fset.Position(posErr.Pos), err)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		funcWrappers = append(funcWrappers, wrappers...)
 	}
 
+	//authenticators are registered once for all the structs, so they are described the same way everywhere
+	authSchemes := make(map[string]*FuncWrapper)
 	serveWrappers := make(map[string]*ServeHTTPWrapper)
 	for _, f := range funcWrappers {
+		if name := f.Options.Auth.Authenticator; name != "" {
+			other, described := authSchemes[name]
+			if described && (other.Options.AuthScheme != f.Options.AuthScheme || other.Options.AuthHeader != f.Options.AuthHeader) {
+				log.Fatalf("%s: %s: authenticator %s is described differently in %s (%s)",
+					pkg.Fset.Position(f.Decl.Pos()), f.FuncName, name, other.FuncName, pkg.Fset.Position(other.Decl.Pos()))
+			}
+			authSchemes[name] = f
+		}
 		if _, serveHTTPWrapperExists := serveWrappers[f.RecvTypeName]; !serveHTTPWrapperExists {
 			serveWrappers[f.RecvTypeName] = &ServeHTTPWrapper{
 				RecvName:     f.RecvName,
@@ -332,33 +985,53 @@ func main() {
 		}
 		curServeWrapper := serveWrappers[f.RecvTypeName]
 
+		if f.Options.Url == OpenAPIPath {
+			log.Fatalf("%s: %s: url %s is reserved for the OpenAPI document", pkg.Fset.Position(f.Decl.Pos()), f.FuncName, OpenAPIPath)
+		}
 		if _, groupByUrlExists := curServeWrapper.Wrappers[f.Options.Url]; !groupByUrlExists {
 			curServeWrapper.Wrappers[f.Options.Url] = make(map[string]*FuncWrapper)
 		}
 		curUrl := curServeWrapper.Wrappers[f.Options.Url]
 
-		if _, methodOccupied := curUrl[f.Options.Method]; methodOccupied {
-			log.Fatalf("2 handlers are on the same URL and Method: %s, %s", curUrl[f.Options.Method].FuncName, f.FuncName)
+		if other, methodOccupied := curUrl[f.Options.Method]; methodOccupied {
+			log.Fatalf("%s: 2 handlers are on the same URL and Method: %s (%s), %s",
+				pkg.Fset.Position(f.Decl.Pos()), other.FuncName, pkg.Fset.Position(other.Decl.Pos()), f.FuncName)
 		}
 		curUrl[f.Options.Method] = f
 	}
 
-	templatePath := "handlers_gen/template.tmpl"
-	tmpl, err := template.ParseFiles(templatePath)
-	if err != nil {
-		log.Fatal(err)
+	for _, serveWrapper := range serveWrappers {
+		spec := NewOpenAPI(serveWrapper)
+		serveWrapper.Spec, err = json.MarshalIndent(spec, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = writeSpec(filepath.Dir(out), serveWrapper, spec, *openapiFormat)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	tmplParams := Template{
-		Package:       node.Name.Name,
+	src, err := generateHandlers(Template{
+		Package:       pkg.Types.Name(),
+		Imports:       pkg.Imports(),
 		ServeWrappers: serveWrappers,
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	err = tmpl.Execute(out, tmplParams)
+	err = os.WriteFile(out, src, 0o644)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if *clientDir != "" {
+		err = writeClient(*clientDir, pkg, serveWrappers)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	//err = packageImportsTmpl.Execute(out, node.Name.Name)
 	//if err != nil {
 	//	log.Fatal(err)
@@ -404,8 +1077,35 @@ func main() {
 	//	log.Fatal(err)
 	//}
 	//newLines(out, 2)
+}
+
+// generateHandlers executes the handlers template and formats the result
+func generateHandlers(params Template) ([]byte, error) {
+	tmpl, err := template.New("template.tmpl").Parse(handlersTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var generated bytes.Buffer
+	if err := tmpl.Execute(&generated, params); err != nil {
+		return nil, err
+	}
+	return formatSource(generated.Bytes())
+}
 
-	fmt.Printf("%#v", serveWrappers)
+// writeSpec writes the document of an api struct to openapi_<struct>.json or .yaml in dir
+func writeSpec(dir string, s *ServeHTTPWrapper, spec *OpenAPI, format string) error {
+	content := s.Spec
+	if format == "yaml" {
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(spec); err != nil {
+			return err
+		}
+		content = buf.Bytes()
+	}
+	name := "openapi_" + strings.ToLower(s.RecvTypeName) + "." + format
+	return os.WriteFile(filepath.Join(dir, name), content, 0o644)
 }
 
 func newLines(w io.Writer, amount int) {
@@ -471,37 +1171,77 @@ func DeclHasReceiver(d *ast.FuncDecl) bool {
 	return true
 }
 
-func FuncDeclToFuncInput(f *ast.FuncDecl) (FuncInput, error) {
+// PosError is an error about a node of the parsed file, main prints it with the position of the node
+type PosError struct {
+	Pos token.Pos
+	Err error
+}
+
+func (e *PosError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PosError) Unwrap() error {
+	return e.Err
+}
+
+func FuncDeclToFuncInput(pkg *Package, f *ast.FuncDecl) (FuncInput, error) {
 	//first parameter is context
-	ident, _ := (f.Type.Params.List[1].Type).(*ast.Ident)
-	typeSpec, _ := (ident.Obj.Decl).(*ast.TypeSpec)
-	structType, _ := (typeSpec.Type).(*ast.StructType)
+	signature, err := funcSignature(pkg, f)
+	if err != nil {
+		return FuncInput{}, err
+	}
+	paramType := signature.Params().At(1).Type()
+	named, ok := types.Unalias(paramType).(*types.Named)
+	if !ok {
+		return FuncInput{}, &PosError{Pos: f.Type.Params.Pos(), Err: fmt.Errorf("params must be a named struct, got %s", pkg.TypeString(paramType))}
+	}
+	structType, ok := named.Underlying().(*types.Struct)
+	if !ok {
+		return FuncInput{}, &PosError{Pos: named.Obj().Pos(), Err: fmt.Errorf("params %s must be a struct", named.Obj().Name())}
+	}
 
 	result := FuncInput{
-		RecvTypeName: ident.Name,
+		RecvTypeName: named.Obj().Name(),
+		TypeName:     pkg.TypeString(named),
 	}
 
-	fields := make([]FuncInputStructField, 0, len(structType.Fields.List))
-	for _, field := range structType.Fields.List {
-		fieldTypeAsIdent, _ := (field.Type).(*ast.Ident)
-		switch fieldTypeAsIdent.Name {
-		case "int", "string":
-		default:
-			continue
-		}
-
-		_, afterTag, ok := strings.Cut(field.Tag.Value, ApiValidatorTagPrefix)
+	fields := make([]FuncInputStructField, 0, structType.NumFields())
+	positions := make(map[string]token.Pos, structType.NumFields())
+	for i := 0; i < structType.NumFields(); i++ {
+		field := structType.Field(i)
+		tagContent, ok := reflect.StructTag(structType.Tag(i)).Lookup(ApiValidatorTag)
 		if !ok {
 			continue
 		}
-		tagContent, _, ok := strings.Cut(afterTag, `"`)
+		if err := pkg.checkType(field.Type()); err != nil {
+			return FuncInput{}, &PosError{Pos: field.Pos(), Err: fmt.Errorf("field %s: %w", field.Name(), err)}
+		}
+		if named.Obj().Pkg() != pkg.Types && !field.Exported() {
+			return FuncInput{}, &PosError{Pos: field.Pos(), Err: fmt.Errorf("field %s of %s can't be set from package %s", field.Name(), result.TypeName, pkg.Types.Name())}
+		}
 
-		funcInputStructField, err := NewFuncInputStructField(ident.Name, field.Names[0].Name, fieldTypeAsIdent.Name == "int", tagContent)
+		funcInputStructField, err := NewFuncInputStructField(result.RecvTypeName, field.Name(), pkg.TypeString(field.Type()), tagContent)
 		if err != nil {
-			return FuncInput{}, err
+			return FuncInput{}, &PosError{Pos: field.Pos(), Err: err}
 		}
+		funcInputStructField.Type = field.Type()
 		fields = append(fields, funcInputStructField)
+		positions[funcInputStructField.Name] = field.Pos()
 	}
 	result.Fields = fields
+
+	for _, field := range fields {
+		for i, otherName := range []string{field.GtField, field.LtField} {
+			if otherName == "" {
+				continue
+			}
+			comparison, err := newFieldComparison(fields, field, otherName, i == 0)
+			if err != nil {
+				return FuncInput{}, &PosError{Pos: positions[field.Name], Err: err}
+			}
+			result.Comparisons = append(result.Comparisons, comparison)
+		}
+	}
 	return result, nil
 }
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checkSource type checks the source of a package api, the standard packages are checked from source too
+func checkSource(t *testing.T, src string) (*Package, *ast.File) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "api.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	config := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	typesPkg, err := config.Check("api", fset, []*ast.File{file}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewPackage(fset, []*ast.File{file}, typesPkg, info), file
+}
+
+func TestNewFuncInputStructField(t *testing.T) {
+	cases := []struct {
+		goType string
+		tag    string
+		err    string
+	}{
+		{goType: "string", tag: "required,len=4"},
+		{goType: "string", tag: "email"},
+		{goType: "[]string", tag: "uuid"},
+		{goType: "int", tag: "oneof=1 2 4"},
+		{goType: "string", tag: "regexp=^a{1,2},b$"},
+		{goType: "time.Time", tag: "gtfield=From"},
+		{goType: "string", tag: "requried", err: `unknown apivalidator label "requried"`},
+		{goType: "int", tag: "email", err: "not supported for int"},
+		{goType: "string", tag: "len=four", err: `bad value "four"`},
+		{goType: "int", tag: "oneof=1 two", err: `bad value "two"`},
+		{goType: "string", tag: "regexp=(", err: "bad regexp"},
+		{goType: "bool", tag: "ltfield=Other", err: "not supported for bool"},
+	}
+	for _, c := range cases {
+		_, err := NewFuncInputStructField("Params", "Field", c.goType, c.tag)
+		if c.err == "" && err != nil {
+			t.Errorf("%s `%s`: unexpected error %v", c.goType, c.tag, err)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s `%s`: expected error with %q, got %v", c.goType, c.tag, c.err, err)
+		}
+	}
+
+	field, _ := NewFuncInputStructField("Params", "Field", "string", "regexp=^a{1,2},b$")
+	if field.Regexp != "^a{1,2},b$" {
+		t.Errorf("regexp with a comma: got %q", field.Regexp)
+	}
+}
+
+func TestFuncDeclToFuncInputErrors(t *testing.T) {
+	cases := []struct {
+		fields string
+		line   int
+		err    string
+	}{
+		{
+			fields: "From int `apivalidator:\"min=1\"`\n\tTill int `apivalidator:\"required,after=From\"`",
+			line:   10,
+			err:    `field Till: unknown apivalidator label "after=From"`,
+		},
+		{
+			fields: "From int\n\tTill int `apivalidator:\"gtfield=From\"`",
+			line:   10,
+			err:    "field Till: no field From to compare with",
+		},
+		{
+			fields: "From string `apivalidator:\"required\"`\n\tTill int `apivalidator:\"ltfield=From\"`",
+			line:   10,
+			err:    "field Till: can't compare int with From of string",
+		},
+	}
+	for _, c := range cases {
+		src := "package api\n\nimport \"context\"\n\ntype Api struct{}\n\ntype Params struct {\n\tName string `json:\"name\"`\n\t" + c.fields + "\n}\n\n" +
+			"// apigen:api {\"url\": \"/\"}\nfunc (a *Api) Do(ctx context.Context, in Params) (int, error) { return 0, nil }\n"
+		pkg, file := checkSource(t, src)
+		funcDecl, err := DeclToFuncDecl(file.Decls[3])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = NewFuncWrapper(pkg, funcDecl)
+		var posErr *PosError
+		if !errors.As(err, &posErr) {
+			t.Errorf("%s: expected PosError, got %v", c.err, err)
+			continue
+		}
+		if line := pkg.Fset.Position(posErr.Pos).Line; line != c.line || !strings.HasSuffix(err.Error(), c.err) {
+			t.Errorf("expected %q at line %d, got %q at line %d", c.err, c.line, err, line)
+		}
+	}
+}
+
+// TestGeneratedFieldNames compiles the handlers of params named as the locals and the imports of the template
+func TestGeneratedFieldNames(t *testing.T) {
+	src := "package api\n\nimport (\n\t\"context\"\n\t\"time\"\n)\n\n" +
+		"type ApiError struct {\n\tHTTPStatus int\n\tErr        error\n}\n\nfunc (ae ApiError) Error() string { return ae.Err.Error() }\n\n" +
+		"type Api struct{}\n\ntype Params struct {\n" +
+		"\tValue float64   `apivalidator:\"min=1\"`\n" +
+		"\tItem  []int     `apivalidator:\"min=1\"`\n" +
+		"\tErrs  string    `apivalidator:\"required\"`\n" +
+		"\tBody  string    `apivalidator:\"from=body,email\"`\n" +
+		"\tIn    int       `apivalidator:\"default=1\"`\n" +
+		"\tTime  time.Time `apivalidator:\"required\"`\n" +
+		"\tCount int       `apivalidator:\"required,default=3\"`\n}\n\n" +
+		"// apigen:api {\"url\": \"/{value}\"}\nfunc (a *Api) Do(ctx context.Context, in Params) (int, error) { return 0, nil }\n"
+	pkg, file := checkSource(t, src)
+	funcDecl, err := DeclToFuncDecl(file.Decls[len(file.Decls)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapper, err := NewFuncWrapper(pkg, funcDecl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := generateHandlers(Template{
+		Package: pkg.Types.Name(),
+		ServeWrappers: map[string]*ServeHTTPWrapper{"Api": {
+			RecvName:     "a",
+			RecvTypeName: "Api",
+			Wrappers:     map[string]map[string]*FuncWrapper{"/{value}": {"": wrapper}},
+			Spec:         []byte("{}"),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(generated), "fieldValue = fieldValue") || !strings.Contains(string(generated), "fieldValue = parsed") {
+		t.Errorf("the parsed value is not assigned:\n%s", generated)
+	}
+	//a required param is never missing, so there is neither a default nor a check for a missing value after the required one
+	if strings.Contains(string(generated), `rawCount = "3"`) || strings.Contains(string(generated), `rawCount != ""`) {
+		t.Errorf("unreachable branches for the required param:\n%s", generated)
+	}
+
+	fset := token.NewFileSet()
+	files := make([]*ast.File, 0, 2)
+	for name, content := range map[string]string{"api.go": src, "api_gen.go": string(generated)} {
+		parsed, err := parser.ParseFile(fset, name, content, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, parsed)
+	}
+	config := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := config.Check("api", fset, files, nil); err != nil {
+		t.Errorf("generated code doesn't compile: %v\n%s", err, generated)
+	}
+}
+
+func TestResultSchema(t *testing.T) {
+	src := `package api
+
+import "time"
+
+type Base struct {
+	ID int ` + "`json:\"id\"`" + `
+}
+
+type Result struct {
+	Base
+	Name    string            ` + "`json:\"name,omitempty\"`" + `
+	Secret  string            ` + "`json:\"-\"`" + `
+	Count   int64             ` + "`json:\"count,string\"`" + `
+	Labels  map[string]string ` + "`json:\"labels\"`" + `
+	Parent  *Result           ` + "`json:\"parent,omitempty\"`" + `
+	Created time.Time
+	hidden  bool
+}
+`
+	pkg, _ := checkSource(t, src)
+	builder := &schemaBuilder{schemas: make(map[string]*Schema), named: make(map[string]*types.Named)}
+	ref := builder.typeSchema(types.NewPointer(pkg.Types.Scope().Lookup("Result").Type()))
+	if ref.Ref != "#/components/schemas/Result" {
+		t.Fatalf("expected a reference to Result, got %+v", ref)
+	}
+
+	result := builder.schemas["Result"]
+	expected := map[string]*Schema{
+		"id":      {Type: "integer"},
+		"name":    {Type: "string"},
+		"count":   {Type: "string"},
+		"labels":  {Type: "object", AdditionalProperties: &Schema{Type: "string"}},
+		"parent":  {Ref: "#/components/schemas/Result"},
+		"Created": {Type: "string", Format: "date-time"},
+	}
+	if !reflect.DeepEqual(result.Properties, expected) {
+		t.Errorf("unexpected properties %+v", result.Properties)
+	}
+	if !reflect.DeepEqual(result.Required, []string{"Created", "count", "id", "labels"}) {
+		t.Errorf("unexpected required %v", result.Required)
+	}
+}
+
+func TestCodegenOptionsAuth(t *testing.T) {
+	cases := []struct {
+		json     string
+		expected AuthOption
+		err      bool
+	}{
+		{json: `{"auth": false}`, expected: AuthOption{}},
+		{json: `{"auth": true}`, expected: AuthOption{Required: true}},
+		{json: `{"auth": "bearer"}`, expected: AuthOption{Required: true, Authenticator: "bearer"}},
+		{json: `{}`, expected: AuthOption{}},
+		{json: `{"auth": ""}`, err: true},
+		{json: `{"auth": 1}`, err: true},
+	}
+	for _, c := range cases {
+		var options CodegenOptions
+		err := json.Unmarshal([]byte(c.json), &options)
+		if (err != nil) != c.err || (err == nil && options.Auth != c.expected) {
+			t.Errorf("%s: got %+v, %v", c.json, options.Auth, err)
+		}
+	}
+}
+
+func TestCodegenOptionsSecurityScheme(t *testing.T) {
+	cases := []struct {
+		json     string
+		expected SecurityScheme
+		err      string
+	}{
+		{json: `{"auth": true}`, expected: SecurityScheme{Type: "apiKey", In: "header", Name: "X-Auth"}},
+		{json: `{"auth": "jwt", "auth_scheme": "Bearer"}`, expected: SecurityScheme{Type: "http", Scheme: "bearer"}},
+		{json: `{"auth": "key", "auth_header": "X-Api-Key"}`, expected: SecurityScheme{Type: "apiKey", In: "header", Name: "X-Api-Key"}},
+		{json: `{"auth": "session"}`, expected: SecurityScheme{Type: "apiKey", In: "header", Name: "Authorization"}},
+		{json: `{"auth": "jwt", "auth_scheme": "jwt"}`, err: "auth_scheme must be one of"},
+		{json: `{"auth": true, "auth_scheme": "bearer"}`, err: "need an authenticator name"},
+		{json: `{"auth": "jwt", "auth_scheme": "bearer", "auth_header": "X-Jwt"}`, err: "can't be set together"},
+	}
+	for _, c := range cases {
+		var options CodegenOptions
+		if err := json.Unmarshal([]byte(c.json), &options); err != nil {
+			t.Fatal(err)
+		}
+		err := options.validate()
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected error with %q, got %v", c.json, c.err, err)
+			}
+			continue
+		}
+		_, scheme := securityScheme(options)
+		scheme.Description = ""
+		if err != nil || scheme != c.expected {
+			t.Errorf("%s: got %+v, %v", c.json, scheme, err)
+		}
+	}
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	if path := openAPIPath("/files/{dir}/{path...}"); path != "/files/{dir}/{path}" {
+		t.Errorf("unexpected path %s", path)
+	}
+}
+
+// TestLoadPackage generates from a package with the methods in several files, the params from another
+// package and a stale output which doesn't compile, unexported fields of the other package can't be set
+func TestLoadPackage(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.22\n",
+		"models/models.go": "package models\n\ntype Status string\n\n" +
+			"type Params struct {\n\tID     int    `apivalidator:\"required\"`\n\tStatus Status `apivalidator:\"from=body\"`\n\tnote   string\n}\n\n" +
+			"type Item struct {\n\tID int `json:\"id\"`\n}\n\n" +
+			"type Hidden struct {\n\tnote string `apivalidator:\"required\"`\n}\n",
+		"api.go": "package shop\n\ntype Api struct{}\n\nfunc NewApi() *Api { return &Api{} }\n\nvar _ = (*Api).ServeHTTP\n",
+		"items.go": "package shop\n\nimport (\n\t\"context\"\n\n\t\"example.com/shop/models\"\n)\n\n" +
+			"// apigen:api {\"url\": \"/items/get\"}\nfunc (a *Api) Get(ctx context.Context, in models.Params) (*models.Item, error) { return nil, nil }\n\n" +
+			"// apigen:api {\"url\": \"/items/hidden\"}\nfunc (a *Api) Hidden(ctx context.Context, in models.Hidden) (int, error) { return 0, nil }\n",
+		"api_gen.go": "package shop\n\nfunc broken( {\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	pkg, err := LoadPackage(".", "api_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkg.TypeErrors) == 0 {
+		t.Error("expected the type errors of the missing ServeHTTP")
+	}
+	var wrappers []*FuncWrapper
+	for _, file := range pkg.Files {
+		for _, funcDecl := range filterMap(file.Decls, DeclToFuncDecl) {
+			wrapper, err := NewFuncWrapper(pkg, funcDecl)
+			if funcDecl.Name.Name == "Hidden" {
+				var posErr *PosError
+				if !errors.As(err, &posErr) || !strings.HasSuffix(err.Error(), "field note of models.Hidden can't be set from package shop") {
+					t.Errorf("unexpected error %v", err)
+				} else if position := pkg.Fset.Position(posErr.Pos); filepath.Base(position.Filename) != "models.go" || position.Line != 16 {
+					t.Errorf("unexpected position %s", position)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			wrappers = append(wrappers, wrapper)
+		}
+	}
+	if len(wrappers) != 1 {
+		t.Fatalf("expected 1 wrapper, got %d", len(wrappers))
+	}
+
+	input := wrappers[0].Input
+	if input.RecvTypeName != "Params" || input.TypeName != "models.Params" {
+		t.Errorf("unexpected params type %s, %s", input.RecvTypeName, input.TypeName)
+	}
+	if len(input.Fields) != 2 || input.Fields[1].GoType != "models.Status" {
+		t.Errorf("unexpected fields %+v", input.Fields)
+	}
+	if imports := pkg.Imports(); !reflect.DeepEqual(imports, []string{`"example.com/shop/models"`}) {
+		t.Errorf("unexpected imports %v", imports)
+	}
+
+	builder := &schemaBuilder{schemas: make(map[string]*Schema), named: make(map[string]*types.Named)}
+	if ref := builder.typeSchema(wrappers[0].Result); ref.Ref != "#/components/schemas/Item" {
+		t.Errorf("expected a reference to Item, got %+v", ref)
+	}
+}
+
+// TestTypeQualifierCollisions checks that the packages with the same name as imported ones get aliases
+func TestTypeQualifierCollisions(t *testing.T) {
+	named := func(path, name string) types.Type {
+		pkg := types.NewPackage(path, name)
+		return types.NewNamed(types.NewTypeName(0, pkg, "T", nil), types.Typ[types.Int], nil)
+	}
+	local := types.NewPackage("example.com/shop", "shop")
+	qualifier := newTypeQualifier(local)
+	cases := []struct {
+		t        types.Type
+		expected string
+	}{
+		{named("example.com/a/models", "models"), "models.T"},
+		{named("example.com/b/models", "models"), "models2.T"},
+		{named("example.com/a/models", "models"), "models.T"},
+		{named("example.com/web/http", "http"), "http2.T"},
+		{named("time", "time"), "time.T"},
+		{types.NewNamed(types.NewTypeName(0, local, "Local", nil), types.Typ[types.Int], nil), "Local"},
+	}
+	for _, c := range cases {
+		if got := qualifier.TypeString(c.t); got != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, got)
+		}
+	}
+	expected := []string{`"example.com/a/models"`, `models2 "example.com/b/models"`, `http2 "example.com/web/http"`, `"time"`}
+	if imports := qualifier.Imports(); !reflect.DeepEqual(imports, expected) {
+		t.Errorf("unexpected imports %v", imports)
+	}
+
+	src := "package shop\n\nimport (\n\t\"net/http\"\n\t\"example.com/a/models\"\n\tmodels2 \"example.com/b/models\"\n\t\"time\"\n\t\"time\"\n)\n\n" +
+		"var _ = http.StatusOK\n\ntype X struct {\n\tA models.T\n\tB models2.T\n}\n"
+	formatted, err := formatSource([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(formatted), `models2 "example.com/b/models"`) || strings.Contains(string(formatted), `"time"`) {
+		t.Errorf("unexpected imports of the formatted source:\n%s", formatted)
+	}
+}
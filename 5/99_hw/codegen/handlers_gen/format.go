@@ -0,0 +1,45 @@
+package main
+
+import (
+	"golang.org/x/tools/imports"
+)
+
+// formatSource gofmts the generated code and drops the imports it doesn't use or repeats,
+// so the template can import everything any generated code may need
+func formatSource(src []byte) ([]byte, error) {
+	return imports.Process("", src, &imports.Options{Comments: true, TabIndent: true, TabWidth: 8})
+}
+
+func filter[T any](elems []T, predicate func(T) bool) []T {
+	res := make([]T, 0, len(elems))
+	for _, el := range elems {
+		if predicate(el) {
+			res = append(res, el)
+		}
+	}
+	return res
+}
+
+// filterMap keeps the results of the elements converted without an error
+func filterMap[T, R any](elems []T, convert func(T) (R, error)) []R {
+	res := make([]R, 0, len(elems))
+	for _, el := range elems {
+		if r, err := convert(el); err == nil {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// tryMap stops at the first element that can't be converted
+func tryMap[T, R any](elems []T, convert func(T) (R, error)) ([]R, error) {
+	res := make([]R, 0, len(elems))
+	for _, el := range elems {
+		r, err := convert(el)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
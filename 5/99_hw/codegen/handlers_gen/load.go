@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Package is the type checked package with the annotated methods, the methods and their params
+// may be in any of its files and the types of the params and results may be from other packages
+type Package struct {
+	Fset  *token.FileSet
+	Types *types.Package
+	Info  *types.Info
+	Files []*ast.File
+	// TypeErrors are expected, the package usually uses the code which is not generated yet,
+	// they are reported only if the types of the handlers are not checked because of them
+	TypeErrors []error
+
+	// qualifier names the types in the generated code of the package
+	qualifier *typeQualifier
+}
+
+func NewPackage(fset *token.FileSet, files []*ast.File, typesPkg *types.Package, info *types.Info) *Package {
+	return &Package{
+		Fset:      fset,
+		Types:     typesPkg,
+		Info:      info,
+		Files:     files,
+		qualifier: newTypeQualifier(typesPkg),
+	}
+}
+
+// LoadPackage loads the package matched by pattern, output is the file the code is generated to,
+// the previous generated code may not compile with the changed api, so it's loaded as an empty file
+// and the errors of the missing code are kept in TypeErrors
+func LoadPackage(pattern string, output string) (*Package, error) {
+	//the dependencies are checked from source as well, their export data would need the package to compile
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo |
+			packages.NeedImports | packages.NeedDeps,
+		Overlay: make(map[string][]byte),
+	}
+	if abs, err := filepath.Abs(output); err == nil {
+		if header, err := parser.ParseFile(token.NewFileSet(), abs, nil, parser.PackageClauseOnly); err == nil {
+			cfg.Overlay[abs] = []byte("package " + header.Name.Name + "\n")
+		}
+	}
+
+	pkgs, err := packages.Load(cfg, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("pattern %s matches %d packages, must be 1", pattern, len(pkgs))
+	}
+	pkg := pkgs[0]
+	var errs, typeErrors []error
+	for _, err := range pkg.Errors {
+		if err.Kind == packages.TypeError {
+			typeErrors = append(typeErrors, err)
+			continue
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	result := NewPackage(pkg.Fset, pkg.Syntax, pkg.Types, pkg.TypesInfo)
+	result.TypeErrors = typeErrors
+	return result, nil
+}
+
+// checkType returns an error with the type errors of the package if the type is not checked
+func (p *Package) checkType(t types.Type) error {
+	if !strings.Contains(types.TypeString(t, nil), "invalid type") {
+		return nil
+	}
+	return fmt.Errorf("type %s is invalid: %w", p.TypeString(t), errors.Join(p.TypeErrors...))
+}
+
+// TypeString is the type as it's written in the generated code of the package
+func (p *Package) TypeString(t types.Type) string {
+	return p.qualifier.TypeString(t)
+}
+
+// Imports are the packages of the types from other packages used in the generated code
+func (p *Package) Imports() []string {
+	return p.qualifier.Imports()
+}
+
+// templateImports are the packages the templates import by their names, other packages with the same name get an alias
+var templateImports = map[string]string{
+	"bytes":   "bytes",
+	"context": "context",
+	"errors":  "errors",
+	"fmt":     "fmt",
+	"http":    "net/http",
+	"io":      "io",
+	"json":    "encoding/json",
+	"mail":    "net/mail",
+	"regexp":  "regexp",
+	"strconv": "strconv",
+	"strings": "strings",
+	"sync":    "sync",
+	"time":    "time",
+	"url":     "net/url",
+}
+
+// typeQualifier qualifies the types of other packages than local and remembers their packages to import them.
+// A package named as an already imported one gets the name with a number, the packages are named in the order
+// they are met, so the generated code is the same on every run as long as the order is
+type typeQualifier struct {
+	local *types.Package
+	// imports are names of the packages by path
+	imports map[string]string
+	// paths are the paths of the packages by name
+	paths map[string]string
+}
+
+func newTypeQualifier(local *types.Package) *typeQualifier {
+	return &typeQualifier{local: local, imports: make(map[string]string), paths: make(map[string]string)}
+}
+
+func (q *typeQualifier) qualify(pkg *types.Package) string {
+	if pkg == q.local {
+		return ""
+	}
+	if name, ok := q.imports[pkg.Path()]; ok {
+		return name
+	}
+	name := pkg.Name()
+	for i := 2; q.taken(name, pkg.Path()); i++ {
+		name = pkg.Name() + strconv.Itoa(i)
+	}
+	q.imports[pkg.Path()] = name
+	q.paths[name] = pkg.Path()
+	return name
+}
+
+// taken reports whether the name is used by another package than the one with importPath
+func (q *typeQualifier) taken(name string, importPath string) bool {
+	if other, ok := q.paths[name]; ok && other != importPath {
+		return true
+	}
+	other, ok := templateImports[name]
+	return ok && other != importPath
+}
+
+func (q *typeQualifier) TypeString(t types.Type) string {
+	return types.TypeString(t, q.qualify)
+}
+
+// Imports are the import specs sorted by path, with the name if it differs from the last element of the path
+func (q *typeQualifier) Imports() []string {
+	paths := make([]string, 0, len(q.imports))
+	for importPath := range q.imports {
+		paths = append(paths, importPath)
+	}
+	sort.Strings(paths)
+
+	specs := make([]string, 0, len(paths))
+	for _, importPath := range paths {
+		spec := strconv.Quote(importPath)
+		if name := q.imports[importPath]; path.Base(importPath) != name {
+			spec = name + " " + spec
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
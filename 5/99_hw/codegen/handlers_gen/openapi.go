@@ -0,0 +1,461 @@
+package main
+
+import (
+	"go/types"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const OpenAPIVersion = "3.0.3"
+
+// OpenAPIPath is the url the generated ServeHTTP serves the document at
+const OpenAPIPath = "/openapi.json"
+
+// OpenAPI is the part of an OpenAPI 3 document the generator fills,
+// it has both json and yaml tags so it can be written in any of the formats
+type OpenAPI struct {
+	OpenAPI    string                          `json:"openapi" yaml:"openapi"`
+	Info       OpenAPIInfo                     `json:"info" yaml:"info"`
+	Paths      map[string]map[string]Operation `json:"paths" yaml:"paths"`
+	Components Components                      `json:"components" yaml:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title" yaml:"title"`
+	Version string `json:"version" yaml:"version"`
+}
+
+type Operation struct {
+	OperationID string                `json:"operationId" yaml:"operationId"`
+	Security    []map[string][]string `json:"security,omitempty" yaml:"security,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty" yaml:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses" yaml:"responses"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name" yaml:"name"`
+	In       string  `json:"in" yaml:"in"`
+	Required bool    `json:"required,omitempty" yaml:"required,omitempty"`
+	Schema   *Schema `json:"schema" yaml:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty" yaml:"required,omitempty"`
+	Content  map[string]MediaType `json:"content" yaml:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema" yaml:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description" yaml:"description"`
+	Content     map[string]MediaType `json:"content,omitempty" yaml:"content,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty" yaml:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty" yaml:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type" yaml:"type"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	In          string `json:"in,omitempty" yaml:"in,omitempty"`
+	Name        string `json:"name,omitempty" yaml:"name,omitempty"`
+	Scheme      string `json:"scheme,omitempty" yaml:"scheme,omitempty"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty" yaml:"type,omitempty"`
+	Format               string             `json:"format,omitempty" yaml:"format,omitempty"`
+	Items                *Schema            `json:"items,omitempty" yaml:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty" yaml:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+	Enum                 []any              `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Default              any                `json:"default,omitempty" yaml:"default,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty" yaml:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty" yaml:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty" yaml:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+}
+
+const authSchemeName = "apiKey"
+
+// securityScheme describes the X-Auth check as an api key. The credentials of a registered authenticator
+// are unknown to the generator, so they are described by auth_scheme or auth_header of the annotation
+func securityScheme(options CodegenOptions) (string, SecurityScheme) {
+	auth := options.Auth
+	if auth.Authenticator == "" {
+		return authSchemeName, SecurityScheme{Type: "apiKey", In: "header", Name: "X-Auth"}
+	}
+	description := "Checked by the authenticator registered as " + strconv.Quote(auth.Authenticator)
+	if options.AuthScheme != "" {
+		return auth.Authenticator, SecurityScheme{Type: "http", Scheme: strings.ToLower(options.AuthScheme), Description: description}
+	}
+	header := options.AuthHeader
+	if header == "" {
+		header = "Authorization"
+	}
+	return auth.Authenticator, SecurityScheme{Type: "apiKey", In: "header", Name: header, Description: description}
+}
+
+// openAPIPath is the url as a path template, OpenAPI has no {name...} wildcards, so they are written as {name}
+func openAPIPath(url string) string {
+	return strings.ReplaceAll(url, "...}", "}")
+}
+
+// NewOpenAPI describes the handlers of one api struct, the structs are described separately
+// as they are served separately and may have the same urls
+func NewOpenAPI(s *ServeHTTPWrapper) *OpenAPI {
+	spec := &OpenAPI{
+		OpenAPI: OpenAPIVersion,
+		Info:    OpenAPIInfo{Title: s.RecvTypeName, Version: "1.0.0"},
+		Paths:   make(map[string]map[string]Operation),
+		Components: Components{
+			Schemas: map[string]*Schema{
+				"Error": {
+					Type:       "object",
+					Properties: map[string]*Schema{"error": {Type: "string"}},
+					Required:   []string{"error"},
+				},
+			},
+		},
+	}
+	schemas := &schemaBuilder{schemas: spec.Components.Schemas, named: make(map[string]*types.Named)}
+
+	//the urls are sorted, so the types with the same name are named the same way on every run
+	urls := make([]string, 0, len(s.Wrappers))
+	for url := range s.Wrappers {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		methods := s.Wrappers[url]
+		operations := make(map[string]Operation)
+		for method, wrapper := range methods {
+			if wrapper.Options.Auth.Required {
+				if spec.Components.SecuritySchemes == nil {
+					spec.Components.SecuritySchemes = make(map[string]SecurityScheme)
+				}
+				name, scheme := securityScheme(wrapper.Options)
+				spec.Components.SecuritySchemes[name] = scheme
+			}
+			//a handler of any method is described as get and post, the methods forms are sent with
+			if method == "" {
+				for _, anyMethod := range []string{"get", "post"} {
+					if _, ok := methods[strings.ToUpper(anyMethod)]; !ok {
+						operations[anyMethod] = schemas.operation(wrapper, anyMethod)
+					}
+				}
+				continue
+			}
+			operations[strings.ToLower(method)] = schemas.operation(wrapper, strings.ToLower(method))
+		}
+		spec.Paths[openAPIPath(url)] = operations
+	}
+	return spec
+}
+
+type schemaBuilder struct {
+	//schemas are the named types referenced with $ref
+	schemas map[string]*Schema
+	//named are the types of the schemas by name
+	named map[string]*types.Named
+}
+
+func (b *schemaBuilder) operation(wrapper *FuncWrapper, method string) Operation {
+	operation := Operation{
+		OperationID: wrapper.FuncName,
+		Responses: map[string]Response{
+			"200": {
+				Description: "OK",
+				Content: jsonContent(&Schema{
+					Type: "object",
+					Properties: map[string]*Schema{
+						"error":    {Type: "string"},
+						"response": b.typeSchema(wrapper.Result),
+					},
+					Required: []string{"error"},
+				}),
+			},
+			"400":     errorResponse("Invalid params, all the failed checks joined with \"; \""),
+			"default": errorResponse("Error of the method"),
+		},
+	}
+	if wrapper.Options.Auth.Required {
+		name, _ := securityScheme(wrapper.Options)
+		operation.Security = []map[string][]string{{name: {}}}
+		operation.Responses["403"] = errorResponse("Unauthorized")
+	}
+
+	form := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	body := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, field := range wrapper.Input.Fields {
+		switch {
+		case field.From == FromBody:
+			addProperty(body, field, b.fieldSchema(field))
+		case field.From == FromForm && method != "get":
+			addProperty(form, field, b.fieldSchema(field))
+		default:
+			in := field.From
+			if in == FromForm {
+				in = FromQuery
+			}
+			operation.Parameters = append(operation.Parameters, Parameter{
+				Name:     field.ParamName(),
+				In:       in,
+				Required: field.IsRequired || field.From == FromPath,
+				Schema:   b.fieldSchema(field),
+			})
+		}
+	}
+	//the form and the json body are decoded from the same request body, so only one of them is described
+	switch {
+	case len(body.Properties) > 0:
+		operation.RequestBody = &RequestBody{Required: len(body.Required) > 0, Content: jsonContent(body)}
+	case len(form.Properties) > 0:
+		operation.RequestBody = &RequestBody{
+			Required: len(form.Required) > 0,
+			Content:  map[string]MediaType{"application/x-www-form-urlencoded": {Schema: form}},
+		}
+	}
+	return operation
+}
+
+func addProperty(object *Schema, field FuncInputStructField, schema *Schema) {
+	object.Properties[field.ParamName()] = schema
+	if field.IsRequired {
+		object.Required = append(object.Required, field.ParamName())
+	}
+}
+
+func jsonContent(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+func errorResponse(description string) Response {
+	return Response{Description: description, Content: jsonContent(&Schema{Ref: "#/components/schemas/Error"})}
+}
+
+// fieldSchema describes a param with the constraints of its apivalidator tag,
+// the constraints of a slice are put on its items as they are checked for every element
+func (b *schemaBuilder) fieldSchema(field FuncInputStructField) *Schema {
+	if field.Kind == KindJSON {
+		if field.Type == nil {
+			return &Schema{}
+		}
+		return b.typeSchema(field.Type)
+	}
+	schema := kindSchema(field.Kind)
+	for _, enum := range field.Enums {
+		schema.Enum = append(schema.Enum, literalValue(field.Kind, enum))
+	}
+	if field.UsesDefault() && !field.IsSlice {
+		schema.Default = literalValue(field.Kind, field.Default)
+	}
+	if field.IsLen() {
+		schema.MinLength = intBound(field.HasMin, field.Min)
+		schema.MaxLength = intBound(field.HasMax, field.Max)
+		if field.HasLen {
+			schema.MinLength = intBound(true, field.Len)
+			schema.MaxLength = intBound(true, field.Len)
+		}
+	} else {
+		schema.Minimum = floatBound(field.HasMin, field.Min)
+		schema.Maximum = floatBound(field.HasMax, field.Max)
+	}
+	if field.HasRegexp {
+		schema.Pattern = field.Regexp
+	}
+	if field.IsEmail {
+		schema.Format = "email"
+	}
+	if field.IsUUID {
+		schema.Format = "uuid"
+	}
+
+	if !field.IsSlice {
+		return schema
+	}
+	array := &Schema{Type: "array", Items: schema}
+	if field.UsesDefault() {
+		array.Default = []any{literalValue(field.Kind, field.Default)}
+	}
+	return array
+}
+
+func kindSchema(kind FieldKind) *Schema {
+	switch kind {
+	case KindInt:
+		return &Schema{Type: "integer"}
+	case KindBool:
+		return &Schema{Type: "boolean"}
+	case KindFloat:
+		return &Schema{Type: "number", Format: "double"}
+	case KindTime:
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	return &Schema{Type: "string"}
+}
+
+// literalValue converts a literal checked by checkLiteral into a value of the kind
+func literalValue(kind FieldKind, literal string) any {
+	switch kind {
+	case KindInt:
+		value, _ := strconv.Atoi(literal)
+		return value
+	case KindFloat:
+		value, _ := strconv.ParseFloat(literal, 64)
+		return value
+	case KindBool:
+		value, _ := strconv.ParseBool(literal)
+		return value
+	}
+	return literal
+}
+
+func intBound(isSet bool, literal string) *int {
+	if !isSet {
+		return nil
+	}
+	value, _ := strconv.Atoi(literal)
+	return &value
+}
+
+func floatBound(isSet bool, literal string) *float64 {
+	if !isSet {
+		return nil
+	}
+	value, _ := strconv.ParseFloat(literal, 64)
+	return &value
+}
+
+// typeSchema describes a type as encoding/json marshals it, the types with their own
+// MarshalJSON are described as any value
+func (b *schemaBuilder) typeSchema(t types.Type) *Schema {
+	switch t := types.Unalias(t).(type) {
+	case *types.Pointer:
+		return b.typeSchema(t.Elem())
+	case *types.Slice:
+		if types.Identical(t.Elem(), types.Typ[types.Byte]) {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.typeSchema(t.Elem())}
+	case *types.Array:
+		return &Schema{Type: "array", Items: b.typeSchema(t.Elem())}
+	case *types.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.typeSchema(t.Elem())}
+	case *types.Struct:
+		return b.structSchema(t)
+	case *types.Named:
+		return b.namedSchema(t)
+	case *types.Basic:
+		return basicSchema(t)
+	}
+	return &Schema{}
+}
+
+func basicSchema(t *types.Basic) *Schema {
+	switch info := t.Info(); {
+	case info&types.IsString != 0:
+		return &Schema{Type: "string"}
+	case info&types.IsBoolean != 0:
+		return &Schema{Type: "boolean"}
+	case info&types.IsInteger != 0:
+		return &Schema{Type: "integer"}
+	case info&types.IsFloat != 0:
+		return &Schema{Type: "number"}
+	}
+	return &Schema{}
+}
+
+func (b *schemaBuilder) namedSchema(named *types.Named) *Schema {
+	switch {
+	case isNamed(named, "time", "Time"):
+		return kindSchema(KindTime)
+	case hasMethod(named, "MarshalJSON"):
+		return &Schema{}
+	case hasMethod(named, "MarshalText"):
+		return &Schema{Type: "string"}
+	}
+	structType, ok := named.Underlying().(*types.Struct)
+	if !ok {
+		return b.typeSchema(named.Underlying())
+	}
+	name := b.schemaName(named)
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+	if _, ok := b.schemas[name]; !ok {
+		//the schema is registered before it's built, so recursive types end up as references to themselves
+		b.schemas[name] = &Schema{}
+		*b.schemas[name] = *b.structSchema(structType)
+	}
+	return ref
+}
+
+// schemaName is the name of the type, a type with the name of another one
+// from a different package is prefixed with the name of its package
+func (b *schemaBuilder) schemaName(named *types.Named) string {
+	name := named.Obj().Name()
+	if other, ok := b.named[name]; ok && other != named && named.Obj().Pkg() != nil {
+		name = named.Obj().Pkg().Name() + "." + name
+	}
+	b.named[name] = named
+	return name
+}
+
+// hasMethod reports whether the type or a pointer to it has the exported method
+func hasMethod(t types.Type, name string) bool {
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), true, nil, name)
+	_, ok := obj.(*types.Func)
+	return ok
+}
+
+// structSchema takes the names and omitempty from the json tags, fields without omitempty
+// are always marshaled, so they are required
+func (b *schemaBuilder) structSchema(structType *types.Struct) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < structType.NumFields(); i++ {
+		field := structType.Field(i)
+		name, options, _ := strings.Cut(reflect.StructTag(structType.Tag(i)).Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+
+		//embedded structs without a json name are marshaled as their fields
+		if field.Embedded() && name == "" {
+			if embedded := b.typeSchema(field.Type()); embedded.Ref != "" {
+				embedded = b.schemas[strings.TrimPrefix(embedded.Ref, "#/components/schemas/")]
+				for propertyName, property := range embedded.Properties {
+					schema.Properties[propertyName] = property
+				}
+				schema.Required = append(schema.Required, embedded.Required...)
+				continue
+			}
+		}
+
+		if !field.Exported() {
+			continue
+		}
+		propertyName := name
+		if propertyName == "" {
+			propertyName = field.Name()
+		}
+		property := b.typeSchema(field.Type())
+		if strings.Contains(","+options+",", ",string,") {
+			property = &Schema{Type: "string"}
+		}
+		schema.Properties[propertyName] = property
+		if !strings.Contains(","+options+",", ",omitempty,") {
+			schema.Required = append(schema.Required, propertyName)
+		}
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
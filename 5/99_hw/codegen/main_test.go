@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -10,6 +12,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"codegenhw/apiclient"
 )
 
 func CheckoutDummy(w http.ResponseWriter, r *http.Request) {
@@ -21,12 +25,14 @@ var (
 )
 
 type Case struct {
-	Method string // GET по-умолчанию в http.NewRequest если передали пустую строку
-	Path   string
-	Query  string
-	Auth   bool
-	Status int
-	Result interface{}
+	Method  string // GET по-умолчанию в http.NewRequest если передали пустую строку
+	Path    string
+	Query   string
+	Body    string // json-тело, если задано - Query уходит в урле
+	Headers map[string]string
+	Auth    bool
+	Status  int
+	Result  interface{}
 }
 
 const (
@@ -285,6 +291,539 @@ func TestOtherApi(t *testing.T) {
 	runTests(t, ts, cases)
 }
 
+func TestItemsApi(t *testing.T) {
+	ts := httptest.NewServer(NewItemsApi())
+	token := map[string]string{"X-Token": "secret"}
+	item := func(fields CR) CR {
+		result := CR{
+			"id":         7,
+			"available":  true,
+			"price":      9.5,
+			"since":      "0001-01-01T00:00:00Z",
+			"tags":       nil,
+			"sizes":      []int{},
+			"dimensions": CR{"width": 0, "height": 0},
+		}
+		for name, value := range fields {
+			result[name] = value
+		}
+		return CR{"error": "", "response": result}
+	}
+
+	cases := []Case{
+		Case{ // все типы из path, query и header
+			Path:    "/items/7",
+			Query:   "available=false&price=9.5&since=2024-01-02T03:04:05Z&tag=aa&tag=bb&size=38&size=40",
+			Headers: token,
+			Status:  http.StatusOK,
+			Result: item(CR{
+				"available": false,
+				"since":     "2024-01-02T03:04:05Z",
+				"tags":      []string{"aa", "bb"},
+				"sizes":     []int{38, 40},
+			}),
+		},
+		Case{ // bool по-умолчанию
+			Path:    "/items/7",
+			Query:   "price=9.5",
+			Headers: token,
+			Status:  http.StatusOK,
+			Result:  item(nil),
+		},
+		Case{
+			Path:    "/items/seven",
+			Query:   "price=9.5",
+			Headers: token,
+			Status:  http.StatusBadRequest,
+			Result:  CR{"error": "id must be int"},
+		},
+		Case{
+			Path:    "/items/0",
+			Query:   "price=9.5",
+			Headers: token,
+			Status:  http.StatusBadRequest,
+			Result:  CR{"error": "id must be >= 1"},
+		},
+		Case{ // значения из path раскодируются, закодированный слеш остаётся в своём сегменте
+			Path:   "/items/find/john%20doe%2Fjr",
+			Status: http.StatusOK,
+			Result: CR{"error": "", "response": CR{
+				"id":         0,
+				"available":  false,
+				"price":      0,
+				"since":      "0001-01-01T00:00:00Z",
+				"tags":       nil,
+				"sizes":      nil,
+				"title":      "john doe/jr",
+				"dimensions": CR{"width": 0, "height": 0},
+			}},
+		},
+		Case{ // шаблон урла совпадает только целиком
+			Path:    "/items/7/extra",
+			Query:   "price=9.5",
+			Headers: token,
+			Status:  http.StatusNotFound,
+			Result:  CR{"error": "unknown method"},
+		},
+		Case{
+			Path:    "/items/7",
+			Query:   "price=9.5",
+			Method:  http.MethodPost,
+			Headers: token,
+			Status:  http.StatusNotAcceptable,
+			Result:  CR{"error": "bad method"},
+		},
+		Case{
+			Path:    "/items/7",
+			Query:   "price=9.5&available=maybe",
+			Headers: token,
+			Status:  http.StatusBadRequest,
+			Result:  CR{"error": "available must be bool"},
+		},
+		Case{
+			Path:    "/items/7",
+			Query:   "price=cheap",
+			Headers: token,
+			Status:  http.StatusBadRequest,
+			Result:  CR{"error": "price must be float64"},
+		},
+		Case{
+			Path:    "/items/7",
+			Query:   "price=0.1",
+			Headers: token,
+			Status:  http.StatusBadRequest,
+			Result:  CR{"error": "price must be >= 0.5"},
+		},
+		Case{
+			Path:    "/items/7",
+			Query:   "price=9.5&since=yesterday",
+			Headers: token,
+			Status:  http.StatusBadRequest,
+			Result:  CR{"error": "since must be time in RFC3339 format"},
+		},
+		Case{ // проверки применяются к каждому элементу
+			Path:    "/items/7",
+			Query:   "price=9.5&tag=aa&tag=b",
+			Headers: token,
+			Status:  http.StatusBadRequest,
+			Result:  CR{"error": "tag len must be >= 2"},
+		},
+		Case{
+			Path:    "/items/7",
+			Query:   "price=9.5&size=38&size=large",
+			Headers: token,
+			Status:  http.StatusBadRequest,
+			Result:  CR{"error": "size must be list of int"},
+		},
+		Case{
+			Path:    "/items/7",
+			Query:   "price=9.5&size=37",
+			Headers: token,
+			Status:  http.StatusBadRequest,
+			Result:  CR{"error": "size must be one of [36, 38, 40]"},
+		},
+		Case{
+			Path:   "/items/7",
+			Query:  "price=9.5",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "X-Token must me not empty"},
+		},
+		Case{ // вложенная структура из json-тела
+			Path:   "/items",
+			Method: http.MethodPost,
+			Body:   `{"title": "Table", "dimensions": {"width": 1.5, "height": 0.75}, "colors": ["red", "blue"]}`,
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":         1,
+					"available":  false,
+					"price":      0,
+					"since":      "0001-01-01T00:00:00Z",
+					"tags":       nil,
+					"sizes":      nil,
+					"title":      "Table",
+					"dimensions": CR{"width": 1.5, "height": 0.75},
+					"colors":     []string{"red", "blue"},
+					"count":      1,
+				},
+			},
+		},
+		Case{
+			Path:   "/items",
+			Method: http.MethodPost,
+			Body:   `{"title": "Table"}`,
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "dimensions must me not empty"},
+		},
+		Case{
+			Path:   "/items",
+			Method: http.MethodPost,
+			Body:   `{"title": "Table", "dimensions": 5}`,
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "dimensions must be Dimensions"},
+		},
+		Case{
+			Path:   "/items",
+			Method: http.MethodPost,
+			Body:   `{"title": "Table", "dimensions": {}, "colors": ["red", "black"]}`,
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "colors must be one of [red, green, blue]"},
+		},
+		Case{
+			Path:   "/items",
+			Method: http.MethodPost,
+			Body:   `{"title": "Table", "dimensions": {}, "count": 11}`,
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "count must be <= 10"},
+		},
+		Case{
+			Path:   "/items",
+			Method: http.MethodPost,
+			Body:   `["Table"]`,
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "body must be a json object"},
+		},
+		Case{ // шаблон урла не перекрывает точный урл
+			Path:   "/items/reserve",
+			Method: http.MethodPost,
+			Query:  "email=guest@example.com&order_id=123e4567-e89b-12d3-a456-426614174000&pin=0042&from=2024-01-02T12:00:00Z&till=2024-01-05T12:00:00Z&promo_code=SALE-15",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"email":      "guest@example.com",
+					"order_id":   "123e4567-e89b-12d3-a456-426614174000",
+					"guests":     2,
+					"nights":     3,
+					"promo_code": "SALE-15",
+				},
+			},
+		},
+		Case{ // все ошибки сразу, по одной на поле
+			Path:   "/items/reserve",
+			Method: http.MethodPost,
+			Query:  "email=Guest <guest@example.com>&pin=42&guests=3&from=2024-01-02T12:00:00Z&till=2024-01-05T12:00:00Z",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "email must be email; pin len must be 4; guests must be one of [1, 2, 4]"},
+		},
+		Case{
+			Path:   "/items/reserve",
+			Method: http.MethodPost,
+			Query:  "email=guest@example.com&order_id=42&pin=0042&from=2024-01-02T12:00:00Z&till=2024-01-05T12:00:00Z&promo_code=sale-15",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "order_id must be uuid; promo_code must match ^[A-Z]{2,4}-[0-9]{1,3}$"},
+		},
+		Case{
+			Path:   "/items/reserve",
+			Method: http.MethodPost,
+			Query:  "email=guest@example.com&pin=0042&from=2024-01-05T12:00:00Z&till=2024-01-02T12:00:00Z",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "till must be greater than from"},
+		},
+		Case{ // сравнение полей только если сами поля прошли проверки
+			Path:   "/items/reserve",
+			Method: http.MethodPost,
+			Query:  "pin=0042&from=2024-01-05T12:00:00Z&till=2024-01-02T12:00:00Z",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "email must me not empty"},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
+
+func TestPluggableAuth(t *testing.T) {
+	ts := httptest.NewServer(NewItemsApi())
+	defer ts.Close()
+
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	bearer := map[string]string{"Authorization": "Bearer alice"}
+
+	// пока что-то не зарегистрировано - 500
+	delete(middleware, "audit")
+	delete(authenticators, "bearer")
+	RegisterMiddleware("request-id", record("request-id"))
+	runTests(t, ts, []Case{
+		Case{
+			Path:    "/items/7",
+			Method:  http.MethodDelete,
+			Headers: bearer,
+			Status:  http.StatusInternalServerError,
+			Result:  CR{"error": "unknown middleware audit"},
+		},
+	})
+	RegisterMiddleware("audit", record("audit"))
+	runTests(t, ts, []Case{
+		Case{
+			Path:    "/items/7",
+			Method:  http.MethodDelete,
+			Headers: bearer,
+			Status:  http.StatusInternalServerError,
+			Result:  CR{"error": "unknown authenticator bearer"},
+		},
+	})
+
+	RegisterAuthenticator("bearer", AuthenticatorFunc(func(r *http.Request) (any, error) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			return nil, fmt.Errorf("no token")
+		}
+		if token == "expired" {
+			return nil, ApiError{http.StatusUnauthorized, fmt.Errorf("token expired")}
+		}
+		return token, nil
+	}))
+	calls = nil
+	runTests(t, ts, []Case{
+		Case{ // принципал из аутентификатора попадает в ctx метода
+			Path:    "/items/7",
+			Method:  http.MethodDelete,
+			Headers: bearer,
+			Status:  http.StatusOK,
+			Result:  CR{"error": "", "response": CR{"id": 7, "by": "alice"}},
+		},
+		Case{
+			Path:   "/items/7",
+			Method: http.MethodDelete,
+			Status: http.StatusForbidden,
+			Result: CR{"error": "unauthorized"},
+		},
+		Case{ // ApiError из аутентификатора отдаётся как есть
+			Path:    "/items/7",
+			Method:  http.MethodDelete,
+			Headers: map[string]string{"Authorization": "Bearer expired"},
+			Status:  http.StatusUnauthorized,
+			Result:  CR{"error": "token expired"},
+		},
+		Case{ // параметры проверяются после авторизации
+			Path:    "/items/0",
+			Method:  http.MethodDelete,
+			Headers: bearer,
+			Status:  http.StatusBadRequest,
+			Result:  CR{"error": "id must be >= 1"},
+		},
+	})
+
+	// middleware оборачивают и авторизацию, первый - внешний
+	expected := []string{"request-id", "audit", "request-id", "audit", "request-id", "audit", "request-id", "audit"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("unexpected middleware calls %v", calls)
+	}
+}
+
+func TestMiddlewareState(t *testing.T) {
+	ts := httptest.NewServer(NewItemsApi())
+	defer ts.Close()
+
+	// лимитер пропускает один запрос на цепочку, цепочка строится один раз
+	var built int
+	RegisterMiddleware("request-id", func(next http.Handler) http.Handler {
+		built++
+		var served int
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served++
+			if served > 1 {
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	RegisterMiddleware("audit", func(next http.Handler) http.Handler { return next })
+	RegisterAuthenticator("bearer", AuthenticatorFunc(func(r *http.Request) (any, error) {
+		return "alice", nil
+	}))
+
+	for i, expected := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/items/7", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("request %d: expected status %d, got %d", i, expected, resp.StatusCode)
+		}
+	}
+	if built != 1 {
+		t.Errorf("middleware chain built %d times, expected 1", built)
+	}
+
+	// новая регистрация сбрасывает цепочки
+	RegisterMiddleware("request-id", func(next http.Handler) http.Handler { return next })
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/items/7", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("after RegisterMiddleware: expected status 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestClient(t *testing.T) {
+	myApi := httptest.NewServer(NewMyApi())
+	defer myApi.Close()
+	itemsApi := httptest.NewServer(NewItemsApi())
+	defer itemsApi.Close()
+	ctx := context.Background()
+
+	my := apiclient.NewMyApiClient(myApi.URL)
+	user, err := my.Profile(ctx, apiclient.ProfileParams{Login: "rvasily"})
+	if err != nil || !reflect.DeepEqual(user, &apiclient.User{ID: 42, Login: "rvasily", FullName: "Vasily Romanov", Status: 20}) {
+		t.Errorf("Profile: got %+v, %v", user, err)
+	}
+
+	// ошибки из конверта - ApiError со статусом ответа
+	var ae apiclient.ApiError
+	_, err = my.Profile(ctx, apiclient.ProfileParams{Login: "nobody"})
+	if !errors.As(err, &ae) || ae.HTTPStatus != http.StatusNotFound || ae.Error() != "user not exist" {
+		t.Errorf("Profile of unknown user: got %v", err)
+	}
+	_, err = my.Create(ctx, apiclient.CreateParams{Login: "new_client_user"})
+	if !errors.As(err, &ae) || ae.HTTPStatus != http.StatusForbidden {
+		t.Errorf("Create without auth: got %v", err)
+	}
+	my.AuthToken = "100500"
+	created, err := my.Create(ctx, apiclient.CreateParams{Login: "new_client_user", Name: "New", Age: 30})
+	if err != nil || created.ID != 43 {
+		t.Errorf("Create: got %+v, %v", created, err)
+	}
+	_, err = my.Create(ctx, apiclient.CreateParams{Login: "short", Status: "root"})
+	if !errors.As(err, &ae) || ae.HTTPStatus != http.StatusBadRequest || ae.Error() != "login len must be >= 10; status must be one of [user, moderator, admin]" {
+		t.Errorf("Create with bad params: got %v", err)
+	}
+
+	items := apiclient.NewItemsApiClient(itemsApi.URL + "/")
+	since := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	item, err := items.Item(ctx, apiclient.ItemParams{
+		ID:    7,
+		Price: 9.5,
+		Since: since,
+		Tags:  []string{"aa", "bb"},
+		Sizes: []int{38, 40},
+		Token: "secret",
+	})
+	expected := &apiclient.Item{ID: 7, Available: true, Price: 9.5, Since: since, Tags: []string{"aa", "bb"}, Sizes: []int{38, 40}}
+	if err != nil || !reflect.DeepEqual(item, expected) {
+		t.Errorf("Item: got %+v, %v", item, err)
+	}
+
+	stored, err := items.Store(ctx, apiclient.StoreParams{
+		Title:      "Table",
+		Dimensions: apiclient.Dimensions{Width: 1.5, Height: 0.75},
+		Colors:     []string{"red"},
+	})
+	if err != nil || stored.Title != "Table" || stored.Dimensions.Width != 1.5 || stored.Count != 1 {
+		t.Errorf("Store: got %+v, %v", stored, err)
+	}
+
+	// параметры с default отправляются и нулевыми, если заданы
+	item, err = items.Item(ctx, apiclient.ItemParams{ID: 7, Available: apiclient.Ptr(false), Price: 1, Token: "secret"})
+	if err != nil || item.Available {
+		t.Errorf("Item with available=false: got %+v, %v", item, err)
+	}
+	stored, err = items.Store(ctx, apiclient.StoreParams{
+		Title:      "Chair",
+		Dimensions: apiclient.Dimensions{Width: 0.5, Height: 1},
+		Count:      apiclient.Ptr(0),
+	})
+	if err != nil || stored.Count != 0 {
+		t.Errorf("Store with count=0: got %+v, %v", stored, err)
+	}
+
+	RegisterMiddleware("request-id", func(next http.Handler) http.Handler { return next })
+	RegisterMiddleware("audit", func(next http.Handler) http.Handler { return next })
+	RegisterAuthenticator("bearer", AuthenticatorFunc(func(r *http.Request) (any, error) {
+		return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), nil
+	}))
+	items.Credentials = map[string]func(r *http.Request){
+		"bearer": func(r *http.Request) { r.Header.Set("Authorization", "Bearer bob") },
+	}
+	deleted, err := items.Delete(ctx, apiclient.DeleteParams{ID: 3})
+	if err != nil || !reflect.DeepEqual(deleted, &apiclient.Deleted{ID: 3, By: "bob"}) {
+		t.Errorf("Delete: got %+v, %v", deleted, err)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	ts := httptest.NewServer(NewItemsApi())
+	defer ts.Close()
+
+	resp, err := client.Get(ts.URL + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected application/json, got %q", ct)
+	}
+
+	var spec struct {
+		OpenAPI string
+		Paths   map[string]map[string]struct {
+			Parameters []struct {
+				Name     string
+				In       string
+				Required bool
+				Schema   map[string]interface{}
+			}
+		}
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]interface{}
+				Required   []string
+			}
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&spec); err != nil {
+		t.Fatalf("cant unpack json: %v", err)
+	}
+
+	if spec.OpenAPI != "3.0.3" {
+		t.Errorf("unexpected openapi version %q", spec.OpenAPI)
+	}
+	for _, path := range []string{"/items/{id}", "/items", "/items/reserve"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("path %s is not described", path)
+		}
+	}
+	params := spec.Paths["/items/{id}"]["get"].Parameters
+	if len(params) != 7 {
+		t.Fatalf("expected 7 params of GET /items/{id}, got %d", len(params))
+	}
+	if p := params[0]; p.Name != "id" || p.In != "path" || !p.Required || p.Schema["minimum"] != 1.0 {
+		t.Errorf("unexpected id param %+v", p)
+	}
+	if p := params[6]; p.Name != "X-Token" || p.In != "header" || !p.Required {
+		t.Errorf("unexpected X-Token param %+v", p)
+	}
+	// omitempty поля не обязательные
+	item := spec.Components.Schemas["Item"]
+	if _, ok := item.Properties["dimensions"]; !ok || !reflect.DeepEqual(item.Required, []string{"available", "dimensions", "id", "price", "since", "sizes", "tags"}) {
+		t.Errorf("unexpected Item schema %+v", item)
+	}
+
+	runTests(t, ts, []Case{
+		Case{
+			Path:   "/openapi.json",
+			Method: http.MethodPost,
+			Status: http.StatusNotAcceptable,
+			Result: CR{"error": "bad method"},
+		},
+	})
+}
+
 func runTests(t *testing.T, ts *httptest.Server, cases []Case) {
 	for idx, item := range cases {
 		var (
@@ -296,7 +835,10 @@ func runTests(t *testing.T, ts *httptest.Server, cases []Case) {
 
 		caseName := fmt.Sprintf("case %d: [%s] %s %s", idx, item.Method, item.Path, item.Query)
 
-		if item.Method == http.MethodPost {
+		if item.Body != "" {
+			req, err = http.NewRequest(item.Method, ts.URL+item.Path+"?"+item.Query, strings.NewReader(item.Body))
+			req.Header.Add("Content-Type", "application/json")
+		} else if item.Method == http.MethodPost {
 			reqBody := strings.NewReader(item.Query)
 			req, err = http.NewRequest(item.Method, ts.URL+item.Path, reqBody)
 			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
@@ -307,6 +849,9 @@ func runTests(t *testing.T, ts *httptest.Server, cases []Case) {
 		if item.Auth {
 			req.Header.Add("X-Auth", "100500")
 		}
+		for name, value := range item.Headers {
+			req.Header.Add(name, value)
+		}
 
 		resp, err := client.Do(req)
 		if err != nil {
@@ -9,6 +9,7 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/m1ker1n/go-generics"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -57,6 +58,13 @@ func (e ErrInvalidFieldType) Error() string {
 	return fmt.Sprintf("field %s have invalid type", string(e))
 }
 
+// ErrInvalidQueryParam is a param of the rows list with an unknown column or operator or a value of a wrong type
+type ErrInvalidQueryParam string
+
+func (e ErrInvalidQueryParam) Error() string {
+	return fmt.Sprintf("query param %s is invalid", string(e))
+}
+
 var (
 	ErrTableNotFound  = errors.New("unknown table")
 	ErrRecordNotFound = errors.New("record not found")
@@ -153,41 +161,227 @@ func (s *MySQLDBExplorerService) GetTables() []string {
 	return tables
 }
 
-func (s *MySQLDBExplorerService) GetTableRows(ctx context.Context, table string, limit, offset int) ([]map[string]any, error) {
+// RowsQuery is the list of rows as it's asked in the query, the columns in it are checked against the table
+type RowsQuery struct {
+	Limit  int
+	Offset int
+	// Fields are the selected columns, all of them if it's empty
+	Fields  []string
+	Order   []OrderBy
+	Filters []Filter
+}
+
+type OrderBy struct {
+	Column string
+	Desc   bool
+}
+
+// Filter is a col__op=value param, the values of the "in" operator are separated by commas
+type Filter struct {
+	Column string
+	Op     string
+	Value  string
+}
+
+// Param is the name of the query param the filter came from
+func (f Filter) Param() string {
+	return f.Column + "__" + f.Op
+}
+
+// rowsStatement is the checked RowsQuery, only the names of the columns of the table get into the sql,
+// all the values are in Args
+type rowsStatement struct {
+	Columns []string
+	// Where and OrderBy start with a space if they are not empty
+	Where   string
+	OrderBy string
+	Args    []any
+}
+
+func newRowsStatement(columns []Column, query RowsQuery) (rowsStatement, error) {
+	byName := make(map[string]Column, len(columns))
+	for _, column := range columns {
+		byName[column.Field] = column
+	}
+
+	var statement rowsStatement
+	for _, field := range query.Fields {
+		if _, ok := byName[field]; !ok {
+			return rowsStatement{}, ErrInvalidQueryParam("fields")
+		}
+		statement.Columns = append(statement.Columns, field)
+	}
+	if len(statement.Columns) == 0 {
+		for _, column := range columns {
+			statement.Columns = append(statement.Columns, column.Field)
+		}
+	}
+
+	conditions := make([]string, 0, len(query.Filters))
+	for _, filter := range query.Filters {
+		column, ok := byName[filter.Column]
+		if !ok {
+			return rowsStatement{}, ErrInvalidQueryParam(filter.Param())
+		}
+		condition, args, err := filterCondition(column, filter)
+		if err != nil {
+			return rowsStatement{}, err
+		}
+		conditions = append(conditions, condition)
+		statement.Args = append(statement.Args, args...)
+	}
+	if len(conditions) > 0 {
+		statement.Where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	orderBy := make([]string, 0, len(query.Order)+1)
+	orderedByKey := false
+	for _, order := range query.Order {
+		column, ok := byName[order.Column]
+		if !ok {
+			return rowsStatement{}, ErrInvalidQueryParam("order")
+		}
+		orderedByKey = orderedByKey || column.Key == "PRI"
+		if order.Desc {
+			orderBy = append(orderBy, fmt.Sprintf("`%s` DESC", order.Column))
+		} else {
+			orderBy = append(orderBy, fmt.Sprintf("`%s`", order.Column))
+		}
+	}
+	// the primary key ends the order, so the pages of LIMIT are stable even if the order is not given
+	// or has equal values
+	if primaryKeyColumn, ok := generics.FindFirst(columns, func(x Column) bool {
+		return x.Key == "PRI"
+	}); ok && !orderedByKey {
+		orderBy = append(orderBy, fmt.Sprintf("`%s`", primaryKeyColumn.Field))
+	}
+	if len(orderBy) > 0 {
+		statement.OrderBy = " ORDER BY " + strings.Join(orderBy, ", ")
+	}
+	return statement, nil
+}
+
+// filterCondition is the sql condition of the filter with the values converted to the type of the column
+func filterCondition(column Column, filter Filter) (string, []any, error) {
+	var operator string
+	switch filter.Op {
+	case "eq":
+		operator = "="
+	case "ne":
+		operator = "<>"
+	case "gt":
+		operator = ">"
+	case "gte":
+		operator = ">="
+	case "lt":
+		operator = "<"
+	case "lte":
+		operator = "<="
+	case "like":
+		if columnKind(column) != "string" {
+			return "", nil, ErrInvalidQueryParam(filter.Param())
+		}
+		operator = "LIKE"
+	case "in":
+		rawValues := strings.Split(filter.Value, ",")
+		args := make([]any, 0, len(rawValues))
+		for _, raw := range rawValues {
+			value, err := columnValue(column, raw)
+			if err != nil {
+				return "", nil, ErrInvalidQueryParam(filter.Param())
+			}
+			args = append(args, value)
+		}
+		placeholders := strings.Join(strings.Split(strings.Repeat("?", len(args)), ""), ", ")
+		return fmt.Sprintf("`%s` IN (%s)", column.Field, placeholders), args, nil
+	default:
+		return "", nil, ErrInvalidQueryParam(filter.Param())
+	}
+
+	value, err := columnValue(column, filter.Value)
+	if err != nil {
+		return "", nil, ErrInvalidQueryParam(filter.Param())
+	}
+	return fmt.Sprintf("`%s` %s ?", column.Field, operator), []any{value}, nil
+}
+
+// columnKind is "int", "float" or "string" by the type of the column without the size and attributes
+func columnKind(column Column) string {
+	columnType := strings.ToLower(column.Type)
+	if i := strings.IndexAny(columnType, "( "); i >= 0 {
+		columnType = columnType[:i]
+	}
+	switch columnType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		return "int"
+	case "float", "double", "decimal", "real":
+		return "float"
+	}
+	return "string"
+}
+
+func columnValue(column Column, raw string) (any, error) {
+	switch columnKind(column) {
+	case "int":
+		return strconv.ParseInt(raw, 10, 64)
+	case "float":
+		return strconv.ParseFloat(raw, 64)
+	}
+	return raw, nil
+}
+
+// GetTableRows returns the page of the rows and the total count of the rows matching the filters
+func (s *MySQLDBExplorerService) GetTableRows(ctx context.Context, table string, query RowsQuery) ([]map[string]any, int64, error) {
 	columns, tableExists := s.tablesColumns[table]
 	if !tableExists {
-		return nil, ErrTableNotFound
+		return nil, 0, ErrTableNotFound
+	}
+	statement, err := newRowsStatement(columns, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The count and the page are read in one repeatable read transaction, so they see the same snapshot
+	// and total agrees with records under concurrent writes.
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, 0, err
 	}
+	defer tx.Rollback()
 
-	results := make([]map[string]any, 0, limit)
 	// At the moment we checked if table is valid with looking up in s.tablesColumns[table].
 	// So there can't be SQL-injection in the table variable.
-	query := fmt.Sprintf("SELECT * FROM `%s` LIMIT ?, ?", table)
-	rows, err := s.db.QueryContext(ctx, query, offset, limit)
-	if err != nil {
-		return nil, err
+	// Analogically with the columns of the statement, the values of the filters are placeholders.
+	var total int64
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM `%s`%s", table, statement.Where)
+	if err := tx.QueryRowContext(ctx, countQuery, statement.Args...).Scan(&total); err != nil {
+		return nil, 0, err
 	}
 
-	//fieldsColumnTypes, err := rows.ColumnTypes()
+	results := make([]map[string]any, 0, query.Limit)
+	colNames := fmt.Sprintf("`%s`", strings.Join(statement.Columns, "`, `"))
+	selectQuery := fmt.Sprintf("SELECT %s FROM `%s`%s%s LIMIT ?, ?", colNames, table, statement.Where, statement.OrderBy)
+	rows, err := tx.QueryContext(ctx, selectQuery, append(statement.Args, query.Offset, query.Limit)...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		scanInto := make([]any, len(columns))
+		scanInto := make([]any, len(statement.Columns))
 		//I must initialize with new(any), without this it doesn't work
 		for i := range scanInto {
 			scanInto[i] = new(any)
 		}
 
 		if err := rows.Scan(scanInto...); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		for i := range scanInto {
 			valPointer, ok := (scanInto[i]).(*any)
 			if !ok {
-				return nil, errors.New("couldn't type assert wtf")
+				return nil, 0, errors.New("couldn't type assert wtf")
 			}
 			val := *valPointer
 
@@ -200,18 +394,21 @@ func (s *MySQLDBExplorerService) GetTableRows(ctx context.Context, table string,
 		}
 
 		rowResult := make(map[string]any)
-		for i, column := range columns {
-			rowResult[column.Field] = scanInto[i]
+		for i, column := range statement.Columns {
+			rowResult[column] = scanInto[i]
 		}
 		results = append(results, rowResult)
 	}
 
 	// Rows.Err will report the last error encountered by Rows.Scan.
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, 0, err
 	}
 
-	return results, nil
+	return results, total, nil
 }
 
 func (s *MySQLDBExplorerService) GetTableRow(ctx context.Context, table string, key any) (map[string]any, error) {
@@ -469,7 +666,7 @@ DataLoop:
 
 type DBExplorerService interface {
 	GetTables() []string
-	GetTableRows(ctx context.Context, table string, limit, offset int) ([]map[string]any, error)
+	GetTableRows(ctx context.Context, table string, query RowsQuery) ([]map[string]any, int64, error)
 	GetTableRow(ctx context.Context, table string, key any) (map[string]any, error)
 	CreateTableRow(ctx context.Context, table string, data map[string]any) (map[string]any, error)
 	UpdateTableRow(ctx context.Context, table string, key any, data map[string]any) (int64, error)
@@ -522,31 +719,66 @@ func (srv *DBExplorer) GetTableRows(w http.ResponseWriter, r *http.Request) {
 		NewErrorResponse(err).Write(w, http.StatusInternalServerError)
 		return
 	}
-	limitRaw, offsetRaw := r.Form.Get("limit"), r.Form.Get("offset")
-	limit, err := strconv.Atoi(limitRaw)
-	if err != nil {
-		limit = 5
-	}
-	offset, err := strconv.Atoi(offsetRaw)
-	if err != nil {
-		offset = 0
-	}
-
-	rows, err := srv.service.GetTableRows(r.Context(), table, limit, offset)
+	rows, total, err := srv.service.GetTableRows(r.Context(), table, parseRowsQuery(r.Form))
 	if err != nil {
 		if errors.Is(err, ErrTableNotFound) {
 			NewErrorResponse(err).Write(w, http.StatusNotFound)
 			return
 		}
+		var invalidParamErr ErrInvalidQueryParam
+		if errors.As(err, &invalidParamErr) {
+			NewErrorResponse(err).Write(w, http.StatusBadRequest)
+			return
+		}
 		NewErrorResponse(err).Write(w, http.StatusInternalServerError)
 		return
 	}
 
 	NewResponse(map[string]any{
 		"records": rows,
+		"total":   total,
 	}).Write(w, http.StatusOK)
 }
 
+// parseRowsQuery takes limit, offset, fields=col,col2, order=col,-col2 and the col__op filters,
+// the other params are ignored, the columns are checked by the service
+func parseRowsQuery(form url.Values) RowsQuery {
+	limitRaw, offsetRaw := form.Get("limit"), form.Get("offset")
+	limit, err := strconv.Atoi(limitRaw)
+	if err != nil || limit < 0 {
+		limit = 5
+	}
+	offset, err := strconv.Atoi(offsetRaw)
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	query := RowsQuery{Limit: limit, Offset: offset}
+
+	if fields := form.Get("fields"); fields != "" {
+		query.Fields = strings.Split(fields, ",")
+	}
+	if order := form.Get("order"); order != "" {
+		for _, column := range strings.Split(order, ",") {
+			desc := strings.HasPrefix(column, "-")
+			query.Order = append(query.Order, OrderBy{Column: strings.TrimPrefix(column, "-"), Desc: desc})
+		}
+	}
+
+	// params are sorted so the same query gives the same sql
+	params := generics.MapKeys(form)
+	sort.Strings(params)
+	for _, param := range params {
+		i := strings.LastIndex(param, "__")
+		if i < 0 {
+			continue
+		}
+		for _, value := range form[param] {
+			query.Filters = append(query.Filters, Filter{Column: param[:i], Op: param[i+2:], Value: value})
+		}
+	}
+	return query
+}
+
 func (srv *DBExplorer) GetTableRow(w http.ResponseWriter, r *http.Request) {
 	table := r.PathValue("table")
 	if table == "" {
@@ -124,6 +124,7 @@ func TestApis(t *testing.T) {
 			Path: "/items",
 			Result: CR{
 				"response": CR{
+					"total": 2,
 					"records": []CR{
 						CR{
 							"id":          1,
@@ -146,6 +147,7 @@ func TestApis(t *testing.T) {
 			Query: "limit=1",
 			Result: CR{
 				"response": CR{
+					"total": 2,
 					"records": []CR{
 						CR{
 							"id":          1,
@@ -162,6 +164,7 @@ func TestApis(t *testing.T) {
 			Query: "limit=1&offset=1",
 			Result: CR{
 				"response": CR{
+					"total": 2,
 					"records": []CR{
 						CR{
 							"id":          2,
@@ -173,6 +176,114 @@ func TestApis(t *testing.T) {
 				},
 			},
 		},
+		Case{
+			Path:  "/items",
+			Query: "fields=id,title&order=-id",
+			Result: CR{
+				"response": CR{
+					"total": 2,
+					"records": []CR{
+						CR{
+							"id":    2,
+							"title": "memcache",
+						},
+						CR{
+							"id":    1,
+							"title": "database/sql",
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "title__like=data%25&updated__eq=rvasily",
+			Result: CR{
+				"response": CR{
+					"total": 1,
+					"records": []CR{
+						CR{
+							"id":          1,
+							"title":       "database/sql",
+							"description": "Рассказать про базы данных",
+							"updated":     "rvasily",
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "id__in=1,2&id__gt=1&fields=id",
+			Result: CR{
+				"response": CR{
+					"total": 1,
+					"records": []CR{
+						CR{
+							"id": 2,
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "limit=1&order=-id",
+			Result: CR{
+				"response": CR{
+					"total": 2,
+					"records": []CR{
+						CR{
+							"id":          2,
+							"title":       "memcache",
+							"description": "Рассказать про мемкеш с примером использования",
+							"updated":     nil,
+						},
+					},
+				},
+			},
+		},
+		// колонки, операторы и значения фильтров проверяются до запроса в базу
+		Case{
+			Path:   "/items",
+			Query:  "fields=id,password",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "query param fields is invalid",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "order=id%20DESC,title",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "query param order is invalid",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "id__gt=1'",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "query param id__gt is invalid",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "id__like=1",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "query param id__like is invalid",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "title__between=a",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "query param title__between is invalid",
+			},
+		},
 		Case{
 			Path: "/items/1",
 			Result: CR{
@@ -476,6 +587,7 @@ func TestApis(t *testing.T) {
 			Query: "limit=1'&offset=1\"",
 			Result: CR{
 				"response": CR{
+					"total": 2,
 					"records": []CR{
 						CR{
 							"user_id":  1,
@@ -569,3 +681,60 @@ func runCases(t *testing.T, ts *httptest.Server, db *sql.DB, cases []Case) {
 	}
 
 }
+
+// TestRowsStatement checks the sql built from the query without a database
+func TestRowsStatement(t *testing.T) {
+	columns := []Column{
+		Column{Field: "id", Type: "int", Key: "PRI", Extra: "auto_increment"},
+		Column{Field: "title", Type: "varchar(255)"},
+		Column{Field: "price", Type: "float"},
+	}
+	query := RowsQuery{
+		Fields: []string{"title", "id"},
+		Order:  []OrderBy{OrderBy{Column: "price", Desc: true}, OrderBy{Column: "id"}},
+		Filters: []Filter{
+			Filter{Column: "id", Op: "in", Value: "1,2,3"},
+			Filter{Column: "price", Op: "gte", Value: "9.5"},
+			Filter{Column: "title", Op: "like", Value: "%' OR 1=1 --"},
+		},
+	}
+	statement, err := newRowsStatement(columns, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := rowsStatement{
+		Columns: []string{"title", "id"},
+		Where:   " WHERE `id` IN (?, ?, ?) AND `price` >= ? AND `title` LIKE ?",
+		OrderBy: " ORDER BY `price` DESC, `id`",
+		Args:    []any{int64(1), int64(2), int64(3), 9.5, "%' OR 1=1 --"},
+	}
+	if !reflect.DeepEqual(statement, expected) {
+		t.Errorf("results not match\nGot : %#v\nWant: %#v", statement, expected)
+	}
+
+	// without order the pages go by the primary key, it also breaks the ties of the other columns
+	statement, err = newRowsStatement(columns, RowsQuery{})
+	if err != nil || !reflect.DeepEqual(statement.Columns, []string{"id", "title", "price"}) || statement.Where != "" || statement.OrderBy != " ORDER BY `id`" {
+		t.Errorf("unexpected statement of the empty query %#v, %v", statement, err)
+	}
+	statement, err = newRowsStatement(columns, RowsQuery{Order: []OrderBy{OrderBy{Column: "title"}}})
+	if err != nil || statement.OrderBy != " ORDER BY `title`, `id`" {
+		t.Errorf("unexpected order of the query by title %q, %v", statement.OrderBy, err)
+	}
+
+	invalid := map[string]RowsQuery{
+		"fields":        RowsQuery{Fields: []string{"id", "`id`"}},
+		"order":         RowsQuery{Order: []OrderBy{OrderBy{Column: "id DESC"}}},
+		"name__eq":      RowsQuery{Filters: []Filter{Filter{Column: "name", Op: "eq", Value: "a"}}},
+		"id__like":      RowsQuery{Filters: []Filter{Filter{Column: "id", Op: "like", Value: "1"}}},
+		"id__in":        RowsQuery{Filters: []Filter{Filter{Column: "id", Op: "in", Value: "1,two"}}},
+		"price__lt":     RowsQuery{Filters: []Filter{Filter{Column: "price", Op: "lt", Value: "cheap"}}},
+		"title__regexp": RowsQuery{Filters: []Filter{Filter{Column: "title", Op: "regexp", Value: "a"}}},
+	}
+	for param, query := range invalid {
+		_, err := newRowsStatement(columns, query)
+		if err != ErrInvalidQueryParam(param) {
+			t.Errorf("[%s] expected invalid param, got %v", param, err)
+		}
+	}
+}